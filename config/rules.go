@@ -0,0 +1,83 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ExtractionRulesFile is the per-domain extraction rules file, kept next to options.json.
+const ExtractionRulesFile = "extraction-rules.json"
+
+// ExtractionRule overrides content extraction for the domains it lists.
+// Selectors are CSS selectors; several content selectors are concatenated in page order.
+type ExtractionRule struct {
+	Domains          []string `json:"domains"`                     // "example.com" also covers subdomains, "*.example.com" only subdomains
+	Content          []string `json:"content,omitempty"`           // Content roots; heuristics run if none match
+	Strip            []string `json:"strip,omitempty"`             // Removed before any extraction
+	Title            string   `json:"title,omitempty"`             // Element holding the title
+	Author           string   `json:"author,omitempty"`            // Element holding the author
+	Date             string   `json:"date,omitempty"`              // Element holding the publish date (datetime/content attrs preferred)
+	FollowPagination bool     `json:"follow_pagination,omitempty"` // Stitch rel=next pages into one document
+}
+
+// NoiseRules tunes which class and id words mark an element as page furniture.
+// Rules match whole words of a class name or id: "share" matches "share-bar" and
+// "shareButtons" but not "shared-article-body"; "more-from" needs both words in a row.
+// The words also weigh candidates down or up when the main content is scored.
+type NoiseRules struct {
+	Negative        []string `json:"negative,omitempty"`         // Words marking noise
+	Positive        []string `json:"positive,omitempty"`         // Words that keep an element despite a negative match
+	ReplaceDefaults bool     `json:"replace_defaults,omitempty"` // Use only these lists instead of extending the built-in ones
+}
+
+// ExtractionRules is the content of ExtractionRulesFile.
+type ExtractionRules struct {
+	Rules []ExtractionRule `json:"rules"`
+	Noise NoiseRules       `json:"noise"`
+}
+
+var extractionRules = newWatchedFile[ExtractionRules](ExtractionRulesFile, "extraction rules")
+
+// GetConfigDir returns the Dexter configuration directory.
+func GetConfigDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join("Dexter", "config")
+	}
+	return filepath.Join(home, "Dexter", "config")
+}
+
+// GetExtractionRules returns the current extraction rules. The file is re-read when
+// it changes on disk, so edits apply without a restart. A missing file means no rules;
+// a broken one keeps the last good rules.
+func GetExtractionRules() *ExtractionRules {
+	return extractionRules.get()
+}
+
+// Match returns the rule for host, preferring the most specific domain pattern.
+func (r *ExtractionRules) Match(host string) *ExtractionRule {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "" {
+		return nil
+	}
+
+	var best *ExtractionRule
+	bestLength := -1
+	for i := range r.Rules {
+		for _, pattern := range r.Rules[i].Domains {
+			pattern = strings.ToLower(strings.TrimSpace(pattern))
+			if domainMatches(host, pattern) && len(pattern) > bestLength {
+				best, bestLength = &r.Rules[i], len(pattern)
+			}
+		}
+	}
+	return best
+}
+
+func domainMatches(host, pattern string) bool {
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return host == pattern || strings.HasSuffix(host, "."+pattern)
+}
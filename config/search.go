@@ -0,0 +1,67 @@
+package config
+
+import "time"
+
+// SearchConfigFile configures the /search providers, kept next to options.json.
+const SearchConfigFile = "search.json"
+
+// Search provider names, as used in SearchConfig.Providers
+const (
+	SearchDuckDuckGo     = "duckduckgo"
+	SearchDuckDuckGoLite = "duckduckgo-lite"
+	SearchSearXNG        = "searxng"
+	SearchBrave          = "brave"
+)
+
+// DefaultSearchProviders is the fallback order when the config names none. Providers
+// that need settings (an instance URL, an API key) are skipped until they have them.
+var DefaultSearchProviders = []string{SearchDuckDuckGo, SearchDuckDuckGoLite, SearchSearXNG, SearchBrave}
+
+// DefaultSearchCacheTTL is how long results are cached when the config doesn't say.
+const DefaultSearchCacheTTL = time.Hour
+
+// SearchConfig is the content of SearchConfigFile.
+type SearchConfig struct {
+	Providers []string      `json:"providers,omitempty"` // Tried in order until one answers
+	CacheTTL  int           `json:"cache_ttl,omitempty"` // Seconds results are cached; negative disables the cache
+	SearXNG   SearXNGConfig `json:"searxng"`
+	Brave     BraveConfig   `json:"brave"`
+}
+
+// SearXNGConfig points at a self-hosted SearXNG instance with the JSON format enabled.
+type SearXNGConfig struct {
+	URL string `json:"url"` // Base URL, e.g. http://127.0.0.1:8888
+}
+
+// BraveConfig holds the Brave Search API key. URL can point at a compatible endpoint.
+type BraveConfig struct {
+	APIKey string `json:"api_key"`
+	URL    string `json:"url,omitempty"` // Defaults to the Brave web search endpoint
+}
+
+var searchConfig = newWatchedFile[SearchConfig](SearchConfigFile, "search config")
+
+// GetSearchConfig returns the current search config, re-read when the file changes.
+// A missing file means the defaults.
+func GetSearchConfig() *SearchConfig {
+	return searchConfig.get()
+}
+
+// ProviderOrder returns the providers to try, in order.
+func (c *SearchConfig) ProviderOrder() []string {
+	if len(c.Providers) > 0 {
+		return c.Providers
+	}
+	return DefaultSearchProviders
+}
+
+// ResultTTL returns how long results are cached, or 0 when they aren't.
+func (c *SearchConfig) ResultTTL() time.Duration {
+	switch {
+	case c.CacheTTL < 0:
+		return 0
+	case c.CacheTTL == 0:
+		return DefaultSearchCacheTTL
+	}
+	return time.Duration(c.CacheTTL) * time.Second
+}
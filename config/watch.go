@@ -0,0 +1,71 @@
+package config
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// configCheckInterval is how often a watched config file is checked for changes.
+const configCheckInterval = 5 * time.Second
+
+// watchedFile is a JSON file in the config directory that is re-read when it changes
+// on disk, so edits apply without a restart. A missing file reads as the zero value;
+// a broken one keeps the last good content.
+type watchedFile[T any] struct {
+	name        string // File name in GetConfigDir()
+	description string // What the file holds, for logs
+
+	mu        sync.Mutex
+	current   *T
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+func newWatchedFile[T any](name, description string) *watchedFile[T] {
+	return &watchedFile[T]{name: name, description: description, current: new(T)}
+}
+
+// get returns the file's current content.
+func (f *watchedFile[T]) get() *T {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if time.Since(f.checkedAt) < configCheckInterval {
+		return f.current
+	}
+	f.checkedAt = time.Now()
+
+	path := filepath.Join(GetConfigDir(), f.name)
+	info, err := os.Stat(path)
+	if err != nil {
+		if !f.modTime.IsZero() {
+			log.Printf("%s removed, clearing: %s", f.description, path)
+		}
+		f.current = new(T)
+		f.modTime = time.Time{}
+		return f.current
+	}
+	if info.ModTime().Equal(f.modTime) {
+		return f.current
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("Failed to read %s %s: %v", f.description, path, err)
+		return f.current
+	}
+	value := new(T)
+	if err := json.Unmarshal(data, value); err != nil {
+		log.Printf("Failed to parse %s %s, keeping previous: %v", f.description, path, err)
+		return f.current
+	}
+
+	f.current = value
+	f.modTime = info.ModTime()
+	log.Printf("Loaded %s from %s", f.description, path)
+	return f.current
+}
@@ -1,8 +1,10 @@
 package endpoints
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -18,15 +20,33 @@ import (
 
 // MetadataResponse represents the structured data extracted from a URL.
 type MetadataResponse struct {
-	URL         string `json:"url"`
-	Title       string `json:"title,omitempty"`
-	Description string `json:"description,omitempty"`
-	ImageURL    string `json:"image_url,omitempty"`
-	Content     string `json:"content,omitempty"`
-	Summary     string `json:"summary,omitempty"`
-	ContentType string `json:"content_type,omitempty"` // e.g., "image/gif", "text/html"
-	Provider    string `json:"provider,omitempty"`     // e.g., "Tenor", "Giphy"
-	Error       string `json:"error,omitempty"`
+	URL                string            `json:"url"`
+	Title              string            `json:"title,omitempty"`
+	Description        string            `json:"description,omitempty"`
+	ImageURL           string            `json:"image_url,omitempty"`
+	Content            string            `json:"content,omitempty"`
+	Summary            string            `json:"summary,omitempty"`
+	ContentType        string            `json:"content_type,omitempty"` // e.g., "image/gif", "text/html"
+	Provider           string            `json:"provider,omitempty"`     // e.g., "Tenor", "Giphy"
+	SiteName           string            `json:"site_name,omitempty"`
+	CanonicalURL       string            `json:"canonical_url,omitempty"` // rel=canonical, else og:url
+	Author             string            `json:"author,omitempty"`
+	PublishedAt        string            `json:"published_at,omitempty"` // As declared by the page, usually ISO 8601
+	ThemeColor         string            `json:"theme_color,omitempty"`
+	IconURL            string            `json:"icon_url,omitempty"`
+	VideoURL           string            `json:"video_url,omitempty"`
+	Card               string            `json:"card,omitempty"` // twitter:card, e.g. "summary_large_image"
+	Labels             []MetadataLabel   `json:"labels,omitempty"`
+	Language           string            `json:"language,omitempty"` // ISO 639-1, detected from the main text
+	LanguageConfidence float64           `json:"language_confidence,omitempty"`
+	Image              *utils.ImageProbe `json:"image,omitempty"`
+	Error              string            `json:"error,omitempty"`
+}
+
+// MetadataLabel is a twitter:labelN/twitter:dataN pair, e.g. "Reading time" / "5 min".
+type MetadataLabel struct {
+	Label string `json:"label"`
+	Data  string `json:"data"`
 }
 
 // MetadataHandler fetches a URL, extracts Open Graph/Twitter Card metadata, and returns it.
@@ -41,27 +61,57 @@ func MetadataHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "URL parameter is required", http.StatusBadRequest)
 		return
 	}
+	ctx, err := cacheContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response, err := fetchMetadata(ctx, targetURL)
+	if errors.Is(err, errInvalidURL) {
+		http.Error(w, "Invalid URL format", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding metadata response: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Update global Web View state
+	go utils.UpdateWebViewState(context.Background(), utils.GetRedisClient(), targetURL, "metadata", response)
+}
+
+// errInvalidURL is returned by fetchMetadata when the target can't be parsed.
+var errInvalidURL = errors.New("invalid URL format")
+
+// fetchMetadata fetches a page (or reads it from the cache) and extracts its metadata.
+func fetchMetadata(ctx context.Context, targetURL string) (MetadataResponse, error) {
 	parsedURL, err := url.Parse(targetURL)
 	if err != nil {
 		log.Printf("Error parsing URL %s: %v", targetURL, err)
-		http.Error(w, "Invalid URL format", http.StatusBadRequest)
-		return
+		return MetadataResponse{}, errInvalidURL
 	}
 
-	ctx := r.Context()
-	var rawHTML string
+	var rawHTML, documentType string
 
-	// Try cache first
+	// Try cache first; cached documents are recognised by their magic bytes
 	rawHTML, err = utils.GetWebViewCache(ctx, targetURL)
-	if err != nil {
+	if err == nil {
+		documentType = utils.DetectDocumentType("", []byte(rawHTML))
+	} else {
 		// Fetch the URL content
 		client := &http.Client{Timeout: 10 * time.Second}
-		req, err := http.NewRequest("GET", targetURL, nil)
+		req, err := http.NewRequestWithContext(ctx, "GET", targetURL, nil)
 		if err != nil {
 			log.Printf("Error creating request for URL %s: %v", targetURL, err)
-			http.Error(w, fmt.Sprintf("Failed to create request: %v", err), http.StatusInternalServerError)
-			return
+			return MetadataResponse{}, fmt.Errorf("failed to create request: %v", err)
 		}
 		// Use a standard Desktop User-Agent to avoid mobile versions or blocking
 		req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
@@ -69,45 +119,123 @@ func MetadataHandler(w http.ResponseWriter, r *http.Request) {
 		resp, err := client.Do(req)
 		if err != nil {
 			log.Printf("Error fetching URL %s: %v", targetURL, err)
-			http.Error(w, fmt.Sprintf("Failed to fetch URL: %v", err), http.StatusInternalServerError)
-			return
+			return MetadataResponse{}, fmt.Errorf("failed to fetch URL: %v", err)
 		}
 		defer func() { _ = resp.Body.Close() }()
 
 		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusNonAuthoritativeInfo {
 			log.Printf("Received non-OK status for URL %s: %d", targetURL, resp.StatusCode)
-			http.Error(w, fmt.Sprintf("Failed to fetch URL, status code: %d", resp.StatusCode), http.StatusInternalServerError)
-			return
+			return MetadataResponse{}, fmt.Errorf("failed to fetch URL, status code: %d", resp.StatusCode)
 		}
 
-		// Detect and convert charset to UTF-8
-		utf8Reader, err := charset.NewReader(resp.Body, resp.Header.Get("Content-Type"))
+		bodyBytes, err := io.ReadAll(resp.Body)
 		if err != nil {
-			log.Printf("Charset detection failed: %v", err)
-			utf8Reader = resp.Body // Fallback
+			return MetadataResponse{}, errors.New("failed to read response body")
 		}
 
-		bodyBytes, err := io.ReadAll(utf8Reader)
-		if err != nil {
-			http.Error(w, "Failed to read response body", http.StatusInternalServerError)
-			return
+		// Documents are cached byte for byte, as /scrape reads them back from the same key
+		contentType := resp.Header.Get("Content-Type")
+		if documentType = utils.DetectDocumentType(contentType, bodyBytes); documentType != "" {
+			rawHTML = string(bodyBytes)
+		} else {
+			// Detect and convert charset to UTF-8
+			utf8Reader, err := charset.NewReader(bytes.NewReader(bodyBytes), contentType)
+			if err != nil {
+				log.Printf("Charset detection failed: %v", err)
+				utf8Reader = bytes.NewReader(bodyBytes) // Fallback
+			}
+			converted, err := io.ReadAll(utf8Reader)
+			if err != nil {
+				return MetadataResponse{}, errors.New("failed to read response body")
+			}
+			rawHTML = string(converted)
 		}
-		rawHTML = string(bodyBytes)
 
 		// Store in cache
 		_ = utils.SetWebViewCache(ctx, targetURL, rawHTML)
 	}
 
+	// Documents have no HTML to read metadata from, only their own properties
+	if documentType != "" {
+		return documentMetadata(targetURL, documentType, rawHTML), nil
+	}
+
 	// Parse HTML from string
 	doc, err := html.Parse(strings.NewReader(rawHTML))
 	if err != nil {
 		log.Printf("Error parsing HTML for URL %s: %v", targetURL, err)
-		http.Error(w, fmt.Sprintf("Failed to parse HTML: %v", err), http.StatusInternalServerError)
-		return
+		return MetadataResponse{}, fmt.Errorf("failed to parse HTML: %v", err)
+	}
+
+	response := pageMetadata(doc, parsedURL)
+	response.URL = targetURL
+
+	// Probe the image itself for its real type, size and animation flag
+	if response.ImageURL != "" {
+		probe, err := utils.ProbeImage(ctx, response.ImageURL)
+		if err != nil {
+			log.Printf("Image probe failed for %s: %v", response.ImageURL, err)
+		} else {
+			response.Image = probe
+			response.ContentType = probe.MimeType
+		}
+
+		host := parsedURL.Host
+		if strings.Contains(host, "tenor.com") {
+			response.Provider = "Tenor"
+		} else if strings.Contains(host, "giphy.com") {
+			response.Provider = "Giphy"
+		} else {
+			response.Provider = strings.Split(host, ".")[0] // e.g., "media.giphy.com" -> "media"
+		}
+	}
+
+	// Detect language from the page's text, cross-checked with what the page declares
+	language := utils.DetectLanguage(utils.PageText(doc), utils.DeclaredLanguages(doc)...)
+	response.Language = language.Language
+	response.LanguageConfidence = language.Confidence
+
+	// Per-domain rules exist because the page's own metadata is wrong, so they win.
+	// Only pages with a rule pay for extracting the content.
+	if utils.HasExtractionRule(targetURL) {
+		if extraction, err := utils.Extract(doc, targetURL); err == nil {
+			if extraction.Title != "" {
+				response.Title = extraction.Title
+			}
+			if extraction.Author != "" {
+				response.Author = extraction.Author
+			}
+			if extraction.Published != "" {
+				response.PublishedAt = extraction.Published
+			}
+		}
+	}
+
+	return response, nil
+}
+
+// documentMetadata describes a PDF, DOCX, ODT or EPUB by its title, author, subject
+// and creation date. Only the first page is read; an unreadable document has no metadata.
+func documentMetadata(targetURL, documentType, body string) MetadataResponse {
+	response := MetadataResponse{URL: targetURL}
+	firstPage, _ := utils.ParsePageRange("1")
+	info, err := utils.ExtractDocument(documentType, []byte(body), firstPage)
+	if err != nil {
+		log.Printf("Error reading %s metadata for URL %s: %v", documentType, targetURL, err)
+		return response
 	}
+	response.Title = info.Title
+	response.Author = info.Author
+	response.Description = info.Subject
+	response.PublishedAt = info.Created
+	return response
+}
 
+// pageMetadata reads the Open Graph, Twitter Card and plain HTML metadata of doc,
+// resolving URLs against parsedURL. /scrape uses it for front matter.
+func pageMetadata(doc *html.Node, parsedURL *url.URL) MetadataResponse {
 	metadata := make(map[string]string)
-	var title string
+	var title, icon, canonical string
 
 	// Traverse for metadata
 	var traverseMetadata func(*html.Node)
@@ -132,6 +260,28 @@ func MetadataHandler(w http.ResponseWriter, r *http.Request) {
 				if strings.HasPrefix(name, "twitter:") {
 					metadata[name] = content
 				}
+				if strings.HasPrefix(property, "article:") && metadata[property] == "" {
+					metadata[property] = content
+				}
+				// Plain HTML fallbacks; theme-color may repeat per media query, first wins
+				switch name {
+				case "description", "author", "theme-color":
+					if metadata[name] == "" {
+						metadata[name] = content
+					}
+				}
+			} else if n.Data == "link" {
+				rel := strings.Fields(strings.ToLower(getAttr(n, "rel")))
+				for _, r := range rel {
+					if (r == "icon" || r == "apple-touch-icon") && icon == "" {
+						icon = getAttr(n, "href")
+						break
+					}
+					if r == "canonical" && canonical == "" {
+						canonical = getAttr(n, "href")
+						break
+					}
+				}
 			} else if n.Data == "title" && title == "" {
 				if n.FirstChild != nil && n.FirstChild.Type == html.TextNode {
 					title = n.FirstChild.Data
@@ -145,9 +295,7 @@ func MetadataHandler(w http.ResponseWriter, r *http.Request) {
 	traverseMetadata(doc)
 
 	// Prioritize Open Graph, then Twitter Card, then generic HTML elements
-	response := MetadataResponse{
-		URL: targetURL,
-	}
+	var response MetadataResponse
 	response.Title = metadata["og:title"]
 	if response.Title == "" {
 		response.Title = metadata["twitter:title"]
@@ -160,39 +308,76 @@ func MetadataHandler(w http.ResponseWriter, r *http.Request) {
 	if response.Description == "" {
 		response.Description = metadata["twitter:description"]
 	}
+	if response.Description == "" {
+		response.Description = metadata["description"]
+	}
+
+	response.SiteName = metadata["og:site_name"]
+	response.Author = metadata["author"]
+	if response.Author == "" {
+		response.Author = metadata["twitter:creator"]
+	}
+	response.PublishedAt = metadata["article:published_time"]
+	response.ThemeColor = metadata["theme-color"]
+	response.Card = metadata["twitter:card"]
+
+	response.VideoURL = metadata["og:video:secure_url"]
+	if response.VideoURL == "" {
+		response.VideoURL = metadata["og:video:url"]
+	}
+	if response.VideoURL == "" {
+		response.VideoURL = metadata["og:video"]
+	}
+	if response.VideoURL != "" {
+		if videoURL, err := parsedURL.Parse(response.VideoURL); err == nil {
+			response.VideoURL = videoURL.String()
+		}
+	}
+
+	if icon != "" {
+		if iconURL, err := parsedURL.Parse(icon); err == nil {
+			response.IconURL = iconURL.String()
+		}
+	}
+
+	for i := 1; ; i++ {
+		label := metadata[fmt.Sprintf("twitter:label%d", i)]
+		data := metadata[fmt.Sprintf("twitter:data%d", i)]
+		if label == "" || data == "" {
+			break
+		}
+		response.Labels = append(response.Labels, MetadataLabel{Label: label, Data: data})
+	}
 
 	response.ImageURL = metadata["og:image"]
 	if response.ImageURL == "" {
 		response.ImageURL = metadata["twitter:image"]
 	}
-
-	// Try to infer content type and provider from the URL
 	if response.ImageURL != "" {
-		if strings.Contains(strings.ToLower(response.ImageURL), ".gif") {
-			response.ContentType = "image/gif"
-		} else if strings.Contains(strings.ToLower(response.ImageURL), ".jpg") || strings.Contains(strings.ToLower(response.ImageURL), ".jpeg") {
-			response.ContentType = "image/jpeg"
-		} else if strings.Contains(strings.ToLower(response.ImageURL), ".png") {
-			response.ContentType = "image/png"
+		if imgURL, err := parsedURL.Parse(response.ImageURL); err == nil {
+			response.ImageURL = imgURL.String()
 		}
+	}
 
-		host := parsedURL.Host
-		if strings.Contains(host, "tenor.com") {
-			response.Provider = "Tenor"
-		} else if strings.Contains(host, "giphy.com") {
-			response.Provider = "Giphy"
-		} else {
-			response.Provider = strings.Split(host, ".")[0] // e.g., "media.giphy.com" -> "media"
+	// The canonical link is more reliable than og:url, which sites often leave at the homepage
+	if canonical == "" {
+		canonical = metadata["og:url"]
+	}
+	if canonical != "" {
+		if canonicalURL, err := parsedURL.Parse(canonical); err == nil && (canonicalURL.Scheme == "http" || canonicalURL.Scheme == "https") {
+			response.CanonicalURL = canonicalURL.String()
 		}
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Printf("Error encoding metadata response: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
+	return response
 
-	// Update global Web View state
-	go utils.UpdateWebViewState(context.Background(), utils.GetRedisClient(), targetURL, "metadata", response)
+}
+
+func getAttr(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
 }
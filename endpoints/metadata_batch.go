@@ -0,0 +1,122 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const (
+	// maxBatchURLs caps a single batch so one caller can't monopolise the service.
+	maxBatchURLs = 50
+	// batchWorkers is how many URLs are fetched at once across all hosts.
+	batchWorkers = 8
+	// batchPerHost is how many URLs are fetched at once from any single host.
+	batchPerHost = 2
+)
+
+// MetadataBatchRequest is the body accepted by MetadataBatchHandler.
+type MetadataBatchRequest struct {
+	URLs []string `json:"urls"`
+}
+
+// MetadataBatchHandler unfurls many URLs concurrently and returns the results in input order.
+// Each item carries its own error so one bad link doesn't fail the batch.
+func MetadataBatchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req MetadataBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	if len(req.URLs) == 0 {
+		http.Error(w, "At least one URL is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.URLs) > maxBatchURLs {
+		http.Error(w, fmt.Sprintf("Too many URLs (max %d)", maxBatchURLs), http.StatusBadRequest)
+		return
+	}
+
+	ctx, err := cacheContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	results := make([]MetadataResponse, len(req.URLs))
+	hosts := newHostLimiter(batchPerHost)
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < min(batchWorkers, len(req.URLs)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				targetURL := req.URLs[idx]
+
+				release := hosts.acquire(batchHostKey(targetURL))
+				response, err := fetchMetadata(ctx, targetURL)
+				release()
+
+				if err != nil {
+					response = MetadataResponse{URL: targetURL, Error: err.Error()}
+				}
+				results[idx] = response
+			}
+		}()
+	}
+
+	for idx := range req.URLs {
+		jobs <- idx
+	}
+	close(jobs)
+	wg.Wait()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		log.Printf("Error encoding metadata batch response: %v", err)
+	}
+}
+
+// batchHostKey groups URLs by host for per-host limiting.
+func batchHostKey(targetURL string) string {
+	u, err := url.Parse(targetURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// hostLimiter hands out a bounded number of concurrent slots per host.
+type hostLimiter struct {
+	mu    sync.Mutex
+	limit int
+	slots map[string]chan struct{}
+}
+
+func newHostLimiter(limit int) *hostLimiter {
+	return &hostLimiter{limit: limit, slots: make(map[string]chan struct{})}
+}
+
+// acquire blocks until a slot for host is free and returns the function that releases it.
+func (h *hostLimiter) acquire(host string) func() {
+	h.mu.Lock()
+	sem, ok := h.slots[host]
+	if !ok {
+		sem = make(chan struct{}, h.limit)
+		h.slots[host] = sem
+	}
+	h.mu.Unlock()
+
+	sem <- struct{}{}
+	return func() { <-sem }
+}
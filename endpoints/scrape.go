@@ -1,12 +1,16 @@
 package endpoints
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,9 +21,26 @@ import (
 
 // ScrapeResponse holds the high-fidelity scraped content
 type ScrapeResponse struct {
-	URL     string `json:"url"`
-	Content string `json:"content"`
-	Error   string `json:"error,omitempty"`
+	URL                string                `json:"url"`
+	Format             string                `json:"format"`
+	Title              string                `json:"title,omitempty"` // From per-domain rules
+	Author             string                `json:"author,omitempty"`
+	PublishedAt        string                `json:"published_at,omitempty"`
+	Content            string                `json:"content"`
+	Blocks             []utils.ContentBlock  `json:"blocks,omitempty"`  // format=json only
+	Matches            []utils.SelectorMatch `json:"matches,omitempty"` // format=json with selector
+	Pages              int                   `json:"pages,omitempty"`   // Pages stitched together
+	Chunks             []utils.Chunk         `json:"chunks,omitempty"`  // With chunk_tokens
+	Links              []utils.Link          `json:"links,omitempty"`   // With link_list
+	Outline            []utils.OutlineEntry  `json:"outline,omitempty"` // With outline=true, in place of the content
+	Thread             *utils.Thread         `json:"thread,omitempty"`  // With mode=thread
+	Source             string                `json:"source"`            // "static" or "rendered" (headless browser)
+	Quality            *utils.ContentQuality `json:"quality,omitempty"`
+	Language           string                `json:"language,omitempty"`
+	LanguageConfidence float64               `json:"language_confidence,omitempty"`
+	Document           *utils.DocumentInfo   `json:"document,omitempty"` // PDF, DOCX, ODT and EPUB metadata and pages
+	Metadata           *utils.FrontMatter    `json:"metadata,omitempty"` // With frontmatter=true; also prepended to Markdown content
+	Error              string                `json:"error,omitempty"`
 }
 
 // ScrapeHandler performs a high-fidelity "Smart Scrape" of a URL
@@ -30,70 +51,332 @@ func ScrapeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := r.Context()
-	var rawHTML string
-	var err error
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "":
+		format = "markdown"
+	case "markdown", "text", "html", "json":
+	default:
+		http.Error(w, "Invalid format (expected markdown, text, html or json)", http.StatusBadRequest)
+		return
+	}
 
-	// Try cache first
-	rawHTML, err = utils.GetWebViewCache(ctx, targetURL)
-	if err != nil {
-		// Fetch URL if not in cache
-		client := &http.Client{Timeout: 15 * time.Second}
-		req, err := http.NewRequest("GET", targetURL, nil)
-		if err != nil {
-			http.Error(w, "Failed to create request", http.StatusInternalServerError)
+	// Mode: article (the default) extracts the main content, thread the posts of a discussion
+	mode := r.URL.Query().Get("mode")
+	switch mode {
+	case "":
+		mode = "article"
+	case "article":
+	case "thread":
+		if format != "markdown" && format != "json" {
+			http.Error(w, "mode=thread requires format=markdown or format=json", http.StatusBadRequest)
 			return
 		}
-		req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+	default:
+		http.Error(w, "Invalid mode (expected article or thread)", http.StatusBadRequest)
+		return
+	}
 
-		resp, err := client.Do(req)
-		if err != nil {
-			log.Printf("Scrape fetch error: %v", err)
-			http.Error(w, fmt.Sprintf("Failed to fetch URL: %v", err), http.StatusServiceUnavailable)
+	// Optional CSS selectors to target (selector) or drop (exclude) parts of the page
+	selector, err := parseSelectorParam(r, "selector")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	exclude, err := parseSelectorParam(r, "exclude")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Pagination: paginate=true follows "next" links, max_pages caps the total
+	paginate := r.URL.Query().Get("paginate")
+	maxPages := defaultMaxPages
+	if v := r.URL.Query().Get("max_pages"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxMaxPages {
+			http.Error(w, fmt.Sprintf("max_pages must be between 1 and %d", maxMaxPages), http.StatusBadRequest)
 			return
 		}
-		defer func() { _ = resp.Body.Close() }()
+		maxPages = n
+	}
 
-		if resp.StatusCode != http.StatusOK {
-			http.Error(w, fmt.Sprintf("URL returned status: %d", resp.StatusCode), http.StatusServiceUnavailable)
+	// Rendering: render=auto retries thin pages in headless Chrome, always/never force it
+	render := r.URL.Query().Get("render")
+	switch render {
+	case "":
+		render = "auto"
+	case "auto", "always", "never":
+	default:
+		http.Error(w, "Invalid render (expected auto, always or never)", http.StatusBadRequest)
+		return
+	}
+
+	// Link rendering: links=inline|reference|footnote|strip, max_links caps how many stay links
+	markdownOpts := utils.MarkdownOptions{Links: r.URL.Query().Get("links")}
+	switch markdownOpts.Links {
+	case "", utils.LinkInline, utils.LinkReference, utils.LinkFootnote, utils.LinkStrip:
+	default:
+		http.Error(w, "Invalid links (expected inline, reference, footnote or strip)", http.StatusBadRequest)
+		return
+	}
+	if v := r.URL.Query().Get("max_links"); v != "" {
+		markdownOpts.MaxLinks, err = strconv.Atoi(v)
+		if err != nil || markdownOpts.MaxLinks < 1 {
+			http.Error(w, "max_links must be a positive integer", http.StatusBadRequest)
 			return
 		}
+	}
 
-		// Detect and convert charset to UTF-8
-		utf8Reader, err := charset.NewReader(resp.Body, resp.Header.Get("Content-Type"))
-		if err != nil {
-			log.Printf("Charset detection failed: %v", err)
-			utf8Reader = resp.Body // Fallback
-		}
+	// Outgoing links: link_list=all|content|internal adds the page's links to the response
+	linkList := r.URL.Query().Get("link_list")
+	switch linkList {
+	case "", utils.LinksAll, utils.LinksContent, utils.LinksInternal:
+	default:
+		http.Error(w, "Invalid link_list (expected all, content or internal)", http.StatusBadRequest)
+		return
+	}
 
-		bodyBytes, err := io.ReadAll(utf8Reader)
-		if err != nil {
-			http.Error(w, "Failed to read response body", http.StatusInternalServerError)
+	// Outline: outline=true returns the headings instead of the content, section=<anchor>
+	// narrows the content to the part under one of them
+	outline := r.URL.Query().Get("outline") == "true" || r.URL.Query().Get("outline") == "1"
+	section := r.URL.Query().Get("section")
+
+	// Front matter: frontmatter=true prepends YAML describing the page to the Markdown
+	frontMatter := r.URL.Query().Get("frontmatter") == "true" || r.URL.Query().Get("frontmatter") == "1"
+	if frontMatter && format != "markdown" {
+		http.Error(w, "frontmatter requires format=markdown", http.StatusBadRequest)
+		return
+	}
+
+	// Chunking: chunk_tokens splits the content, overlap repeats context between chunks
+	var chunkTokens, overlap int
+	var estimator utils.TokenEstimator
+	if v := r.URL.Query().Get("chunk_tokens"); v != "" {
+		if format != "markdown" && format != "text" {
+			http.Error(w, "chunk_tokens requires format=markdown or format=text", http.StatusBadRequest)
+			return
+		}
+		chunkTokens, err = strconv.Atoi(v)
+		if err != nil || chunkTokens < minChunkTokens || chunkTokens > maxChunkTokens {
+			http.Error(w, fmt.Sprintf("chunk_tokens must be between %d and %d", minChunkTokens, maxChunkTokens), http.StatusBadRequest)
+			return
+		}
+		if v := r.URL.Query().Get("overlap"); v != "" {
+			overlap, err = strconv.Atoi(v)
+			if err != nil || overlap < 0 || overlap >= chunkTokens {
+				http.Error(w, "overlap must be at least 0 and less than chunk_tokens", http.StatusBadRequest)
+				return
+			}
+		}
+		tokenizer := r.URL.Query().Get("tokenizer")
+		if tokenizer == "" {
+			tokenizer = utils.DefaultTokenEstimator
+		}
+		var ok bool
+		if estimator, ok = utils.GetTokenEstimator(tokenizer); !ok {
+			http.Error(w, fmt.Sprintf("Unknown tokenizer: %s", tokenizer), http.StatusBadRequest)
 			return
 		}
-		rawHTML = string(bodyBytes)
+	}
 
-		// Store in cache
-		_ = utils.SetWebViewCache(ctx, targetURL, rawHTML)
+	// Documents: page_range limits which PDF pages or EPUB chapters are extracted, e.g. 1-3,7
+	var pageRange utils.PageRange
+	if v := r.URL.Query().Get("page_range"); v != "" {
+		if pageRange, err = utils.ParsePageRange(v); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 	}
 
-	// Parse HTML from string
-	doc, err := html.Parse(strings.NewReader(rawHTML))
+	// Caching: cache=bypass fetches the page again rather than reading the cached copy
+	ctx, err := cacheContext(r)
 	if err != nil {
-		http.Error(w, "Failed to parse HTML", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Perform Smart Extraction
-	content, err := utils.ExtractMainContent(doc, targetURL)
+	page, err := fetchScrapePage(ctx, targetURL)
+	if errors.Is(err, errPageTooLarge) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
 	if err != nil {
-		// Fallback to empty content if extraction fails (should be rare with fallback to body)
-		content = ""
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
 	}
 
 	response := ScrapeResponse{
-		URL:     targetURL,
-		Content: content,
+		URL:    targetURL,
+		Format: format,
+		Source: "static",
+	}
+	var mainText string
+	var declared []string
+	var extraction *utils.Extraction
+	var doc *html.Node // The page's DOM; nil for documents
+
+	if page.documentType != "" {
+		// Documents have no page around the content: selectors, pagination and rendering don't apply
+		info, err := utils.ExtractDocument(page.documentType, []byte(page.body), pageRange)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to extract %s: %v", strings.ToUpper(page.documentType), err), http.StatusUnprocessableEntity)
+			return
+		}
+		response.Document = info
+
+		// DOCX, ODT and EPUB convert to HTML and render like a page; PDFs are plain text
+		if extraction = info.Extraction(targetURL); extraction == nil {
+			mainText = info.Text()
+			response.Title = info.Title
+			response.Author = info.Author
+			response.PublishedAt = info.Created
+			switch format {
+			case "markdown", "text":
+				response.Content = mainText
+			case "html":
+				response.Content = info.HTML()
+			}
+		}
+	} else if mode == "thread" {
+		// Discussions: the posts are the content, so article extraction doesn't run
+		var thread *utils.Thread
+		thread, doc, response.Source, err = extractThread(ctx, page.body, targetURL, render)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to extract thread: %v", err), http.StatusUnprocessableEntity)
+			return
+		}
+		declared = utils.DeclaredLanguages(doc)
+		response.Thread = thread
+		response.Title = thread.Title
+		mainText = thread.Text()
+		if format == "markdown" {
+			response.Content = thread.Markdown()
+		}
+	} else {
+		// Parse HTML from string
+		doc, err = html.Parse(strings.NewReader(page.body))
+		if err != nil {
+			http.Error(w, "Failed to parse HTML", http.StatusInternalServerError)
+			return
+		}
+		declared = utils.DeclaredLanguages(doc)
+
+		// Perform Smart Extraction
+		// Fallback to empty content if extraction fails (should be rare with fallback to body)
+		var extractErr error
+		extraction, extractErr = utils.Select(doc, targetURL, selector, exclude)
+		quality := utils.ContentQuality{Reasons: []string{"no content found"}}
+		if extractErr == nil {
+			quality = extraction.Quality()
+		}
+
+		// Thin results are usually single-page apps: retry on the browser-rendered DOM
+		if render == "always" || render == "auto" && quality.Score < utils.MinContentQuality {
+			rendered, renderedDoc, err := extractRendered(ctx, targetURL, selector, exclude)
+			if err != nil {
+				log.Printf("Rendered extraction failed for %s: %v", targetURL, err)
+			} else if renderedQuality := rendered.Quality(); render == "always" || renderedQuality.Score > quality.Score {
+				extraction, extractErr, quality, doc = rendered, nil, renderedQuality, renderedDoc
+				response.Source = "rendered"
+			}
+		}
+		response.Quality = &quality
+
+		if extractErr == nil {
+			// Per-domain rules can turn pagination on; an explicit paginate param wins
+			follow := paginate == "true" || paginate == "1"
+			if paginate == "" && extraction.Rule != nil {
+				follow = extraction.Rule.FollowPagination
+			}
+			response.Pages = 1
+			if follow {
+				response.Pages = stitchPages(ctx, extraction, doc, targetURL, maxPages, selector, exclude)
+			}
+		} else {
+			extraction = nil
+		}
+	}
+
+	if section != "" {
+		var found bool
+		if extraction != nil {
+			extraction, found = extraction.Section(section)
+		}
+		if !found {
+			http.Error(w, fmt.Sprintf("No section with anchor %q", section), http.StatusNotFound)
+			return
+		}
+	}
+
+	if extraction != nil {
+		mainText = extraction.Text()
+		response.Title = extraction.Title
+		response.Author = extraction.Author
+		response.PublishedAt = extraction.Published
+		switch {
+		case outline:
+			response.Outline = extraction.Outline()
+		case format == "markdown":
+			response.Content = extraction.MarkdownWith(markdownOpts)
+		case format == "text":
+			response.Content = mainText
+		case format == "html":
+			response.Content = extraction.HTML()
+		case format == "json":
+			if response.Matches = extraction.Matches(); response.Matches == nil {
+				response.Blocks = extraction.Blocks()
+			}
+		}
+		if linkList != "" {
+			response.Links = extraction.Links(linkList)
+		}
+	}
+
+	language := utils.DetectLanguage(mainText, declared...)
+	response.Language = language.Language
+	response.LanguageConfidence = language.Confidence
+
+	if frontMatter {
+		// Front matter reads the same tags as /metadata, from the DOM the content came from
+		var pageMeta MetadataResponse
+		if parsedURL, err := url.Parse(targetURL); err == nil && doc != nil {
+			pageMeta = pageMetadata(doc, parsedURL)
+		}
+
+		// Per-domain rules and document metadata win over the page's own tags, as in /metadata
+		meta := utils.FrontMatter{
+			Title:       response.Title,
+			URL:         pageMeta.CanonicalURL,
+			SiteName:    pageMeta.SiteName,
+			Author:      response.Author,
+			Published:   response.PublishedAt,
+			Language:    response.Language,
+			FetchedAt:   time.Now().UTC().Format(time.RFC3339),
+			ContentHash: utils.ContentHash(response.Content),
+		}
+		if meta.Title == "" {
+			meta.Title = pageMeta.Title
+		}
+		if meta.URL == "" {
+			meta.URL = targetURL
+		}
+		if meta.Author == "" {
+			meta.Author = pageMeta.Author
+		}
+		if meta.Published == "" {
+			meta.Published = pageMeta.PublishedAt
+		}
+		response.Metadata = &meta
+		if format == "markdown" && response.Content != "" {
+			// Outlines have no content to prepend to; the metadata field carries it alone
+			response.Content = meta.YAML() + "\n" + response.Content
+		}
+	}
+
+	// Chunked last, so offsets point into the content as returned, front matter included
+	if chunkTokens > 0 && response.Content != "" {
+		response.Chunks = utils.ChunkMarkdown(response.Content, chunkTokens, overlap, estimator)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -104,3 +387,201 @@ func ScrapeHandler(w http.ResponseWriter, r *http.Request) {
 	// Update global Web View state
 	go utils.UpdateWebViewState(context.Background(), utils.GetRedisClient(), targetURL, "scrape", response)
 }
+
+// Limits for chunk_tokens
+const (
+	minChunkTokens = 16
+	maxChunkTokens = 100000
+)
+
+// Page limits for paginate=true
+const (
+	defaultMaxPages = 5
+	maxMaxPages     = 20
+)
+
+// stitchPages follows "next page" links from doc, appending each page's extraction to
+// first, until there is no next page or maxPages pages have been read. A page that fails
+// to load or extract ends the run. Returns the number of pages in first.
+func stitchPages(ctx context.Context, first *utils.Extraction, doc *html.Node, pageURL string, maxPages int, selector, exclude *utils.Selector) int {
+	pages := 1
+	visited := map[string]bool{pageURL: true}
+	for pages < maxPages {
+		nextURL := utils.FindNextPage(doc, pageURL)
+		if nextURL == "" || visited[nextURL] {
+			break
+		}
+		visited[nextURL] = true
+
+		page, err := fetchScrapePage(ctx, nextURL)
+		if err != nil {
+			log.Printf("Pagination stopped at %s: %v", nextURL, err)
+			break
+		}
+		if page.documentType != "" {
+			break
+		}
+		doc, err = html.Parse(strings.NewReader(page.body))
+		if err != nil {
+			break
+		}
+		extraction, err := utils.Select(doc, nextURL, selector, exclude)
+		if err != nil {
+			log.Printf("Pagination stopped at %s: %v", nextURL, err)
+			break
+		}
+
+		first.Append(extraction)
+		pageURL = nextURL
+		pages++
+	}
+	return pages
+}
+
+// renderTimeout bounds the headless browser fallback
+const renderTimeout = 60 * time.Second
+
+// extractRendered loads targetURL in headless Chrome and extracts from the rendered DOM.
+func extractRendered(ctx context.Context, targetURL string, selector, exclude *utils.Selector) (*utils.Extraction, *html.Node, error) {
+	doc, err := renderedDocument(ctx, targetURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	extraction, err := utils.Select(doc, targetURL, selector, exclude)
+	if err != nil {
+		return nil, nil, err
+	}
+	return extraction, doc, nil
+}
+
+// extractThread extracts the discussion from body, or from the browser-rendered page when
+// render=always or when render=auto and the static page has none. Also returns the DOM the
+// thread came from and "static" or "rendered".
+func extractThread(ctx context.Context, body, targetURL, render string) (*utils.Thread, *html.Node, string, error) {
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return nil, nil, "", err
+	}
+	thread, err := utils.ExtractThread(doc, targetURL)
+	if render == "always" || render == "auto" && err != nil {
+		renderedDoc, renderErr := renderedDocument(ctx, targetURL)
+		if renderErr != nil {
+			log.Printf("Rendered thread extraction failed for %s: %v", targetURL, renderErr)
+		} else if renderedThread, renderedErr := utils.ExtractThread(renderedDoc, targetURL); renderedErr == nil {
+			return renderedThread, renderedDoc, "rendered", nil
+		}
+	}
+	return thread, doc, "static", err
+}
+
+// renderedDocument loads targetURL in headless Chrome and parses the rendered DOM.
+// Rendered pages are cached like fetched ones, under their own key.
+func renderedDocument(ctx context.Context, targetURL string) (*html.Node, error) {
+	cacheKey := "rendered:" + targetURL
+	rawHTML, err := utils.GetWebViewCache(ctx, cacheKey)
+	if err != nil {
+		renderCtx, cancel := context.WithTimeout(ctx, renderTimeout)
+		defer cancel()
+		page, err := renderPage(renderCtx, targetURL, true)
+		if err != nil {
+			return nil, err
+		}
+		rawHTML = page.content
+		_ = utils.SetWebViewCache(ctx, cacheKey, rawHTML)
+	}
+	return html.Parse(strings.NewReader(rawHTML))
+}
+
+// Largest response body /scrape will read, which bounds PDFs in particular
+const maxScrapeBodySize = 50 << 20
+
+// errPageTooLarge is returned by fetchScrapePage for bodies over maxScrapeBodySize.
+var errPageTooLarge = fmt.Errorf("Document too large (over %d MB)", maxScrapeBodySize>>20)
+
+// scrapedPage is a fetched response: UTF-8 HTML, or the raw bytes of a document.
+type scrapedPage struct {
+	body         string
+	documentType string // From utils.DetectDocumentType; empty for HTML
+}
+
+// fetchScrapePage fetches targetURL, from the cache when possible. HTML is converted
+// to UTF-8; documents such as PDFs are kept byte for byte.
+func fetchScrapePage(ctx context.Context, targetURL string) (scrapedPage, error) {
+	// Try cache first; cached documents are recognised by their magic bytes
+	if body, err := utils.GetWebViewCache(ctx, targetURL); err == nil {
+		return scrapedPage{body: body, documentType: utils.DetectDocumentType("", []byte(body))}, nil
+	}
+
+	client := &http.Client{Timeout: 15 * time.Second}
+	req, err := http.NewRequestWithContext(ctx, "GET", targetURL, nil)
+	if err != nil {
+		return scrapedPage{}, fmt.Errorf("Failed to create request: %v", err)
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Printf("Scrape fetch error: %v", err)
+		return scrapedPage{}, fmt.Errorf("Failed to fetch URL: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return scrapedPage{}, fmt.Errorf("URL returned status: %d", resp.StatusCode)
+	}
+
+	// One byte over the limit tells a body that was cut off from one that fits exactly
+	bodyBytes, err := io.ReadAll(io.LimitReader(resp.Body, maxScrapeBodySize+1))
+	if err != nil {
+		return scrapedPage{}, errors.New("Failed to read response body")
+	}
+	if len(bodyBytes) > maxScrapeBodySize {
+		return scrapedPage{}, errPageTooLarge
+	}
+	contentType := resp.Header.Get("Content-Type")
+	page := scrapedPage{
+		documentType: utils.DetectDocumentType(contentType, bodyBytes),
+	}
+
+	if page.documentType != "" {
+		page.body = string(bodyBytes)
+	} else {
+		// Detect and convert charset to UTF-8
+		utf8Reader, err := charset.NewReader(bytes.NewReader(bodyBytes), contentType)
+		if err != nil {
+			log.Printf("Charset detection failed: %v", err)
+			utf8Reader = bytes.NewReader(bodyBytes) // Fallback
+		}
+		converted, err := io.ReadAll(utf8Reader)
+		if err != nil {
+			return scrapedPage{}, errors.New("Failed to read response body")
+		}
+		page.body = string(converted)
+	}
+
+	// Store in cache
+	_ = utils.SetWebViewCache(ctx, targetURL, page.body)
+	return page, nil
+}
+
+// parseSelectorParam compiles the CSS selector in query parameter name, if present.
+func parseSelectorParam(r *http.Request, name string) (*utils.Selector, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	return utils.ParseSelector(value)
+}
+
+// cacheContext reads the cache parameter. cache=bypass skips cached pages and
+// results for this request, fetching them again and refreshing the cache.
+func cacheContext(r *http.Request) (context.Context, error) {
+	switch r.URL.Query().Get("cache") {
+	case "":
+		return r.Context(), nil
+	case "bypass":
+		return utils.WithCacheBypass(r.Context()), nil
+	default:
+		return nil, errors.New("Invalid cache (expected bypass)")
+	}
+}
@@ -1,15 +1,20 @@
 package endpoints
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
-	"golang.org/x/net/html"
+	"github.com/EasterCompany/dex-web-service/config"
+	"github.com/EasterCompany/dex-web-service/utils"
 )
 
 type SearchResult struct {
@@ -18,7 +23,45 @@ type SearchResult struct {
 	Snippet string `json:"snippet"`
 }
 
-// SearchHandler performs a search via DuckDuckGo HTML
+// SearchResponse holds the results and the provider that answered. /search writes the
+// results as a bare array, as it always has, and the rest as headers.
+type SearchResponse struct {
+	Query    string         `json:"query"`
+	Provider string         `json:"provider"`
+	Results  []SearchResult `json:"results"`
+	CachedAt time.Time      `json:"cached_at"` // When the provider answered; earlier than now when served from the cache
+}
+
+// SearchRequest is a query as passed to a SearchProvider, which maps the options onto
+// its own parameters.
+type SearchRequest struct {
+	Query  string
+	Limit  int    // Results wanted
+	Offset int    // Results skipped before the first one returned
+	Region string // DuckDuckGo region code (kl), e.g. us-en or wt-wt; "" for the provider's default
+	Safe   string // off, moderate or strict; "" for the provider's default
+	Time   string // day, week, month or year; "" for any time
+}
+
+// SearchProvider runs web searches on one engine.
+type SearchProvider interface {
+	Name() string
+	Search(ctx context.Context, req SearchRequest) ([]SearchResult, error)
+}
+
+// Limits for the limit and offset parameters
+const (
+	defaultSearchLimit = 10
+	maxSearchLimit     = 50
+	maxSearchOffset    = 200
+)
+
+var reSearchRegion = regexp.MustCompile(`^[a-z]{2}-[a-z]{2}$`)
+
+// ErrSearchCaptcha is returned by providers that were answered with a bot check.
+var ErrSearchCaptcha = errors.New("captcha challenge")
+
+// SearchHandler runs a web search, trying the configured providers in order
 func SearchHandler(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query().Get("q")
 	if query == "" {
@@ -26,117 +69,177 @@ func SearchHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// DuckDuckGo HTML Search URL
-	searchURL := fmt.Sprintf("https://html.duckduckgo.com/html/?q=%s", url.QueryEscape(query))
-
-	client := &http.Client{Timeout: 15 * time.Second}
-	req, _ := http.NewRequest("GET", searchURL, nil)
-	// Important: DuckDuckGo HTML needs a real-looking User-Agent
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
-
-	resp, err := client.Do(req)
+	req, err := parseSearchRequest(r)
 	if err != nil {
-		log.Printf("Search error: %v", err)
-		http.Error(w, "Failed to perform search", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	defer func() { _ = resp.Body.Close() }()
 
-	if resp.StatusCode != http.StatusOK {
-		http.Error(w, fmt.Sprintf("DuckDuckGo returned status: %d", resp.StatusCode), http.StatusServiceUnavailable)
+	// Caching: cache=bypass asks the providers again rather than reading cached results
+	ctx, err := cacheContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	doc, err := html.Parse(resp.Body)
+	response, err := cachedSearch(ctx, config.GetSearchConfig(), req)
 	if err != nil {
-		http.Error(w, "Failed to parse search results", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
 		return
 	}
 
-	var results []SearchResult
-	var traverse func(*html.Node)
-	traverse = func(n *html.Node) {
-		if n.Type == html.ElementNode && n.Data == "div" {
-			// DuckDuckGo HTML results are in divs with class 'result' or 'web-result'
-			isResult := false
-			for _, attr := range n.Attr {
-				if attr.Key == "class" && (strings.Contains(attr.Val, "result") || strings.Contains(attr.Val, "web-result")) {
-					isResult = true
-					break
-				}
-			}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Search-Provider", response.Provider)
+	w.Header().Set("X-Cached-At", response.CachedAt.Format(time.RFC3339))
+	if err := json.NewEncoder(w).Encode(response.Results); err != nil {
+		log.Printf("Error encoding search response: %v", err)
+	}
+}
 
-			if isResult {
-				res := parseSearchResult(n)
-				if res.URL != "" && !strings.Contains(res.URL, "duckduckgo.com/y.js") { // Filter ads
-					results = append(results, res)
-				}
-			}
+// parseSearchRequest reads q, limit, page or offset, region, safe and time.
+func parseSearchRequest(r *http.Request) (SearchRequest, error) {
+	params := r.URL.Query()
+	req := SearchRequest{
+		Query:  params.Get("q"),
+		Limit:  defaultSearchLimit,
+		Region: strings.ToLower(params.Get("region")),
+		Safe:   params.Get("safe"),
+		Time:   params.Get("time"),
+	}
+
+	if v := params.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxSearchLimit {
+			return req, fmt.Errorf("limit must be between 1 and %d", maxSearchLimit)
+		}
+		req.Limit = n
+	}
+
+	page, offset := params.Get("page"), params.Get("offset")
+	switch {
+	case page != "" && offset != "":
+		return req, errors.New("Use either page or offset, not both")
+	case page != "":
+		n, err := strconv.Atoi(page)
+		if err != nil || n < 1 {
+			return req, errors.New("page must be a positive integer")
 		}
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			traverse(c)
+		req.Offset = (n - 1) * req.Limit
+	case offset != "":
+		n, err := strconv.Atoi(offset)
+		if err != nil || n < 0 {
+			return req, errors.New("offset must be 0 or more")
 		}
+		req.Offset = n
+	}
+	if req.Offset > maxSearchOffset {
+		return req, fmt.Errorf("Results past %d are not available", maxSearchOffset)
 	}
-	traverse(doc)
 
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(results)
+	if req.Region != "" && !reSearchRegion.MatchString(req.Region) {
+		return req, errors.New("Invalid region (expected a DuckDuckGo region code such as us-en or wt-wt)")
+	}
+	switch req.Safe {
+	case "", "off", "moderate", "strict":
+	default:
+		return req, errors.New("Invalid safe (expected off, moderate or strict)")
+	}
+	switch req.Time {
+	case "", "day", "week", "month", "year":
+	default:
+		return req, errors.New("Invalid time (expected day, week, month or year)")
+	}
+	return req, nil
 }
 
-func parseSearchResult(n *html.Node) SearchResult {
-	var res SearchResult
-	var traverse func(*html.Node)
-	traverse = func(n *html.Node) {
-		if n.Type == html.ElementNode {
-			if n.Data == "a" {
-				for _, attr := range n.Attr {
-					if attr.Key == "class" && strings.Contains(attr.Val, "result__a") {
-						// This is the title and link
-						res.Title = getText(n)
-						for _, a := range n.Attr {
-							if a.Key == "href" {
-								// DDG uses relative links or redirects sometimes, but HTML version is usually clean
-								u, err := url.Parse(a.Val)
-								if err == nil {
-									// Extract real URL from DDG redirect if needed
-									if u.Path == "/l/" {
-										res.URL = u.Query().Get("uddg")
-									} else {
-										res.URL = a.Val
-									}
-								}
-							}
-						}
-					}
-				}
-			}
-			if n.Data == "a" && res.Snippet == "" {
-				for _, attr := range n.Attr {
-					if attr.Key == "class" && strings.Contains(attr.Val, "result__snippet") {
-						res.Snippet = getText(n)
-					}
-				}
+// cacheKey identifies the results of req independently of the query's case and
+// spacing and of the order the parameters were given in.
+func (req SearchRequest) cacheKey() string {
+	params := url.Values{}
+	params.Set("q", strings.ToLower(strings.Join(strings.Fields(req.Query), " ")))
+	params.Set("limit", strconv.Itoa(req.Limit))
+	params.Set("offset", strconv.Itoa(req.Offset))
+	params.Set("region", req.Region)
+	params.Set("safe", req.Safe)
+	params.Set("time", req.Time)
+	return params.Encode() // Sorted by name
+}
+
+// cachedSearch returns cached results for req when there are any, and otherwise runs
+// the search and caches the answer for cfg.ResultTTL().
+func cachedSearch(ctx context.Context, cfg *config.SearchConfig, req SearchRequest) (SearchResponse, error) {
+	ttl := cfg.ResultTTL()
+	key := req.cacheKey()
+	if ttl > 0 {
+		if cached, err := utils.GetSearchCache(ctx, key); err == nil {
+			var response SearchResponse
+			if err := json.Unmarshal([]byte(cached), &response); err == nil {
+				response.Query = req.Query // As asked, not as first cached
+				return response, nil
 			}
 		}
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			traverse(c)
+	}
+
+	response, err := runSearch(ctx, searchProviders(cfg), req)
+	if err != nil {
+		return response, err
+	}
+	response.CachedAt = time.Now().UTC()
+	if ttl > 0 {
+		if data, err := json.Marshal(response); err == nil {
+			_ = utils.SetSearchCache(ctx, key, string(data), ttl)
 		}
 	}
-	traverse(n)
-	return res
+	return response, nil
 }
 
-func getText(n *html.Node) string {
-	var sb strings.Builder
-	var traverse func(*html.Node)
-	traverse = func(n *html.Node) {
-		if n.Type == html.TextNode {
-			sb.WriteString(n.Data)
+// runSearch tries providers in order and returns the first answer. A provider that
+// fails or is shown a captcha hands over to the next one.
+func runSearch(ctx context.Context, providers []SearchProvider, req SearchRequest) (SearchResponse, error) {
+	if len(providers) == 0 {
+		return SearchResponse{}, errors.New("No search providers configured")
+	}
+
+	var failures []string
+	for _, provider := range providers {
+		results, err := provider.Search(ctx, req)
+		if err != nil {
+			log.Printf("Search provider %s failed: %v", provider.Name(), err)
+			failures = append(failures, fmt.Sprintf("%s: %v", provider.Name(), err))
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		if results == nil {
+			results = []SearchResult{}
 		}
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			traverse(c)
+		return SearchResponse{Query: req.Query, Provider: provider.Name(), Results: results}, nil
+	}
+	return SearchResponse{}, fmt.Errorf("All search providers failed (%s)", strings.Join(failures, "; "))
+}
+
+// searchProviders builds the fallback chain from cfg. Unknown names and providers
+// missing their settings are skipped.
+func searchProviders(cfg *config.SearchConfig) []SearchProvider {
+	var providers []SearchProvider
+	for _, name := range cfg.ProviderOrder() {
+		switch name {
+		case config.SearchDuckDuckGo:
+			providers = append(providers, duckDuckGoHTML{})
+		case config.SearchDuckDuckGoLite:
+			providers = append(providers, duckDuckGoLite{})
+		case config.SearchSearXNG:
+			if cfg.SearXNG.URL != "" {
+				providers = append(providers, searXNG{baseURL: cfg.SearXNG.URL})
+			}
+		case config.SearchBrave:
+			if cfg.Brave.APIKey != "" {
+				providers = append(providers, braveSearch{apiKey: cfg.Brave.APIKey, endpoint: cfg.Brave.URL})
+			}
+		default:
+			log.Printf("Unknown search provider in %s: %q", config.SearchConfigFile, name)
 		}
 	}
-	traverse(n)
-	return strings.TrimSpace(sb.String())
+	return providers
 }
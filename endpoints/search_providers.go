@@ -0,0 +1,475 @@
+package endpoints
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EasterCompany/dex-web-service/config"
+	"golang.org/x/net/html"
+)
+
+// Largest search response read from any provider
+const maxSearchBodySize = 5 << 20
+
+// Most result pages read for one request, whatever the offset and limit
+const maxSearchPages = 10
+
+const defaultBraveEndpoint = "https://api.search.brave.com/res/v1/web/search"
+
+// Brave returns at most 20 results per request, and its offset (in pages) stops at 9
+const (
+	braveMaxCount  = 20
+	braveMaxOffset = 9
+)
+
+// Important: DuckDuckGo needs a real-looking User-Agent
+const searchUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+
+var searchClient = &http.Client{Timeout: 15 * time.Second}
+
+// Markers of DuckDuckGo's bot check page
+var ddgCaptchaMarkers = [][]byte{[]byte("anomaly-modal"), []byte("bots use DuckDuckGo"), []byte("/anomaly.js")}
+
+var reSnippetTags = regexp.MustCompile(`<[^>]*>`)
+
+// duckDuckGoHTML scrapes html.duckduckgo.com.
+type duckDuckGoHTML struct{}
+
+func (duckDuckGoHTML) Name() string { return config.SearchDuckDuckGo }
+
+func (duckDuckGoHTML) Search(ctx context.Context, req SearchRequest) ([]SearchResult, error) {
+	return searchDuckDuckGo(ctx, "https://html.duckduckgo.com/html/", req, parseDuckDuckGoHTML)
+}
+
+// duckDuckGoLite scrapes lite.duckduckgo.com, a lighter page that is often still
+// served when the HTML version is rate limited.
+type duckDuckGoLite struct{}
+
+func (duckDuckGoLite) Name() string { return config.SearchDuckDuckGoLite }
+
+func (duckDuckGoLite) Search(ctx context.Context, req SearchRequest) ([]SearchResult, error) {
+	return searchDuckDuckGo(ctx, "https://lite.duckduckgo.com/lite/", req, parseDuckDuckGoLite)
+}
+
+// searXNG queries a self-hosted SearXNG instance's JSON API.
+type searXNG struct {
+	baseURL string
+}
+
+func (searXNG) Name() string { return config.SearchSearXNG }
+
+func (s searXNG) Search(ctx context.Context, req SearchRequest) ([]SearchResult, error) {
+	params := url.Values{"q": {req.Query}, "format": {"json"}}
+	if req.Region != "" {
+		country, language := regionParts(req.Region)
+		if country == "" {
+			params.Set("language", "all")
+		} else {
+			params.Set("language", language+"-"+strings.ToUpper(country))
+		}
+	}
+	if req.Safe != "" {
+		params.Set("safesearch", map[string]string{"off": "0", "moderate": "1", "strict": "2"}[req.Safe])
+	}
+	if req.Time != "" {
+		params.Set("time_range", req.Time) // SearXNG uses the same names
+	}
+
+	page := 0
+	return collectPages(req.Offset, req.Limit, func() ([]SearchResult, bool, error) {
+		page++
+		params.Set("pageno", strconv.Itoa(page))
+		searchURL := strings.TrimSuffix(s.baseURL, "/") + "/search?" + params.Encode()
+
+		var body struct {
+			Results []struct {
+				Title   string `json:"title"`
+				URL     string `json:"url"`
+				Content string `json:"content"`
+			} `json:"results"`
+		}
+		if err := fetchSearchJSON(ctx, searchURL, nil, &body); err != nil {
+			return nil, false, err
+		}
+
+		results := make([]SearchResult, 0, len(body.Results))
+		for _, r := range body.Results {
+			results = append(results, SearchResult{Title: r.Title, URL: r.URL, Snippet: r.Content})
+		}
+		return results, len(results) > 0, nil
+	})
+}
+
+// braveSearch calls the Brave Search API, or a compatible endpoint, with an API key.
+type braveSearch struct {
+	apiKey   string
+	endpoint string
+}
+
+func (braveSearch) Name() string { return config.SearchBrave }
+
+func (b braveSearch) Search(ctx context.Context, req SearchRequest) ([]SearchResult, error) {
+	endpoint := b.endpoint
+	if endpoint == "" {
+		endpoint = defaultBraveEndpoint
+	}
+	params := url.Values{"q": {req.Query}, "count": {strconv.Itoa(braveMaxCount)}}
+	if req.Region != "" {
+		if country, language := regionParts(req.Region); country != "" {
+			params.Set("country", strings.ToUpper(country))
+			params.Set("search_lang", language)
+		}
+	}
+	if req.Safe != "" {
+		params.Set("safesearch", req.Safe) // Brave uses the same names
+	}
+	if req.Time != "" {
+		params.Set("freshness", map[string]string{"day": "pd", "week": "pw", "month": "pm", "year": "py"}[req.Time])
+	}
+	headers := map[string]string{"X-Subscription-Token": b.apiKey}
+
+	// Brave's offset counts pages of count results, so start from the page holding req.Offset
+	page := req.Offset / braveMaxCount
+	return collectPages(req.Offset%braveMaxCount, req.Limit, func() ([]SearchResult, bool, error) {
+		if page > braveMaxOffset {
+			return nil, false, nil
+		}
+		params.Set("offset", strconv.Itoa(page))
+		page++
+
+		var body struct {
+			Query struct {
+				MoreResults bool `json:"more_results_available"`
+			} `json:"query"`
+			Web struct {
+				Results []struct {
+					Title       string `json:"title"`
+					URL         string `json:"url"`
+					Description string `json:"description"`
+				} `json:"results"`
+			} `json:"web"`
+		}
+		if err := fetchSearchJSON(ctx, endpoint+"?"+params.Encode(), headers, &body); err != nil {
+			return nil, false, err
+		}
+
+		results := make([]SearchResult, 0, len(body.Web.Results))
+		for _, r := range body.Web.Results {
+			// Descriptions mark the matched words with <strong>
+			snippet := html.UnescapeString(reSnippetTags.ReplaceAllString(r.Description, ""))
+			results = append(results, SearchResult{Title: html.UnescapeString(r.Title), URL: r.URL, Snippet: snippet})
+		}
+		return results, body.Query.MoreResults, nil
+	})
+}
+
+// searchDuckDuckGo runs a search on DuckDuckGo's HTML or Lite page at pageURL. Later
+// pages are fetched the way a browser would: by submitting the page's "Next" form.
+func searchDuckDuckGo(ctx context.Context, pageURL string, req SearchRequest, parse func(*html.Node) []SearchResult) ([]SearchResult, error) {
+	form := url.Values{"q": {req.Query}}
+	if req.Region != "" {
+		form.Set("kl", req.Region)
+	}
+	if req.Safe != "" {
+		form.Set("kp", map[string]string{"off": "-2", "moderate": "-1", "strict": "1"}[req.Safe])
+	}
+	if req.Time != "" {
+		form.Set("df", req.Time[:1]) // d, w, m or y
+	}
+
+	action := pageURL
+	return collectPages(req.Offset, req.Limit, func() ([]SearchResult, bool, error) {
+		if form == nil {
+			return nil, false, nil
+		}
+		httpReq, err := http.NewRequestWithContext(ctx, "POST", action, strings.NewReader(form.Encode()))
+		if err != nil {
+			return nil, false, err
+		}
+		httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		doc, err := fetchDuckDuckGo(httpReq)
+		if err != nil {
+			return nil, false, err
+		}
+
+		// The next form repeats the query; the filters are set again in case it leaves them blank
+		next, nextForm := duckDuckGoNextPage(doc, httpReq.URL)
+		for _, key := range []string{"kl", "kp", "df"} {
+			if v := form.Get(key); v != "" && nextForm != nil {
+				nextForm.Set(key, v)
+			}
+		}
+		action, form = next, nextForm
+		return parse(doc), form != nil, nil
+	})
+}
+
+// duckDuckGoNextPage finds the form behind a result page's "Next" button and returns
+// its action, resolved against base, and its fields. The form is nil on the last page.
+func duckDuckGoNextPage(doc *html.Node, base *url.URL) (string, url.Values) {
+	var action string
+	var fields url.Values
+	var find func(*html.Node)
+	find = func(n *html.Node) {
+		for c := n.FirstChild; c != nil && fields == nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && c.Data == "form" && isNextPageForm(c) {
+				target, err := base.Parse(getAttr(c, "action"))
+				if err != nil {
+					return
+				}
+				action, fields = target.String(), url.Values{}
+				var inputs func(*html.Node)
+				inputs = func(n *html.Node) {
+					for c := n.FirstChild; c != nil; c = c.NextSibling {
+						if c.Type == html.ElementNode && c.Data == "input" && getAttr(c, "type") == "hidden" && getAttr(c, "name") != "" {
+							fields.Add(getAttr(c, "name"), getAttr(c, "value"))
+						}
+						inputs(c)
+					}
+				}
+				inputs(c)
+				return
+			}
+			find(c)
+		}
+	}
+	find(doc)
+	return action, fields
+}
+
+// isNextPageForm reports whether form has a submit button labelled "Next" (HTML) or
+// "Next Page >" (Lite).
+func isNextPageForm(form *html.Node) bool {
+	found := false
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil && !found; c = c.NextSibling {
+			if c.Type == html.ElementNode && c.Data == "input" && getAttr(c, "type") == "submit" &&
+				strings.HasPrefix(strings.TrimSpace(getAttr(c, "value")), "Next") {
+				found = true
+			}
+			walk(c)
+		}
+	}
+	walk(form)
+	return found
+}
+
+// collectPages calls next for successive result pages until it has skip+limit distinct
+// results, next reports the last page, or maxSearchPages have been read, and returns
+// the limit results after the first skip.
+func collectPages(skip, limit int, next func() ([]SearchResult, bool, error)) ([]SearchResult, error) {
+	var results []SearchResult
+	seen := make(map[string]bool)
+	for page := 0; page < maxSearchPages && len(results) < skip+limit; page++ {
+		pageResults, more, err := next()
+		if err != nil {
+			if page > 0 {
+				break // Keep what the earlier pages gave
+			}
+			return nil, err
+		}
+		for _, r := range pageResults {
+			if !seen[r.URL] {
+				seen[r.URL] = true
+				results = append(results, r)
+			}
+		}
+		if !more {
+			break
+		}
+	}
+	if skip >= len(results) {
+		return []SearchResult{}, nil
+	}
+	return results[skip:min(len(results), skip+limit)], nil
+}
+
+// regionParts splits a DuckDuckGo region code like "us-en" into country and language.
+// The worldwide region "wt-wt" has neither. DuckDuckGo's "uk" is the ISO code "gb".
+func regionParts(region string) (country, language string) {
+	country, language, _ = strings.Cut(region, "-")
+	switch country {
+	case "wt", "xa", "xl":
+		return "", ""
+	case "uk":
+		country = "gb"
+	}
+	return country, language
+}
+
+// fetchDuckDuckGo sends req and parses the result page, recognising the bot check
+// DuckDuckGo shows when it rate limits (often with status 202).
+func fetchDuckDuckGo(req *http.Request) (*html.Node, error) {
+	req.Header.Set("User-Agent", searchUserAgent)
+	resp, err := searchClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSearchBodySize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+	for _, marker := range ddgCaptchaMarkers {
+		if bytes.Contains(body, marker) {
+			return nil, ErrSearchCaptcha
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return html.Parse(bytes.NewReader(body))
+}
+
+// fetchSearchJSON GETs searchURL with headers and decodes the JSON response into v.
+func fetchSearchJSON(ctx context.Context, searchURL string, headers map[string]string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", searchURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := searchClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxSearchBodySize)).Decode(v); err != nil {
+		return fmt.Errorf("invalid JSON response: %v", err)
+	}
+	return nil
+}
+
+// parseDuckDuckGoHTML reads the results of an html.duckduckgo.com page, without ads.
+func parseDuckDuckGoHTML(doc *html.Node) []SearchResult {
+	var results []SearchResult
+	var traverse func(*html.Node)
+	traverse = func(n *html.Node) {
+		// DuckDuckGo HTML results are divs with the class 'result' (next to 'web-result');
+		// the 'results' list around them and the 'result__body' inside them are not
+		if n.Type == html.ElementNode && n.Data == "div" && slices.Contains(strings.Fields(getAttr(n, "class")), "result") {
+			res := parseSearchResult(n)
+			if res.URL != "" && !strings.Contains(res.URL, "duckduckgo.com/y.js") { // Filter ads
+				results = append(results, res)
+			}
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			traverse(c)
+		}
+	}
+	traverse(doc)
+	return results
+}
+
+func parseSearchResult(n *html.Node) SearchResult {
+	var res SearchResult
+	var traverse func(*html.Node)
+	traverse = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			if n.Data == "a" {
+				for _, attr := range n.Attr {
+					if attr.Key == "class" && strings.Contains(attr.Val, "result__a") {
+						// This is the title and link
+						res.Title = getText(n)
+						for _, a := range n.Attr {
+							if a.Key == "href" {
+								res.URL = duckDuckGoTarget(a.Val)
+							}
+						}
+					}
+				}
+			}
+			if n.Data == "a" && res.Snippet == "" {
+				for _, attr := range n.Attr {
+					if attr.Key == "class" && strings.Contains(attr.Val, "result__snippet") {
+						res.Snippet = getText(n)
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			traverse(c)
+		}
+	}
+	traverse(n)
+	return res
+}
+
+// parseDuckDuckGoLite reads the results of a lite.duckduckgo.com page: a table where
+// each result-link row is followed by its result-snippet cell. Sponsored rows are skipped.
+func parseDuckDuckGoLite(doc *html.Node) []SearchResult {
+	var results []SearchResult
+	sponsored := false
+	var traverse func(*html.Node)
+	traverse = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			class := " " + getAttr(n, "class") + " "
+			switch {
+			case n.Data == "tr":
+				sponsored = strings.Contains(class, " result-sponsored ")
+			case sponsored:
+			case n.Data == "a" && strings.Contains(class, " result-link "):
+				if target := duckDuckGoTarget(getAttr(n, "href")); target != "" && !strings.Contains(target, "duckduckgo.com/y.js") {
+					results = append(results, SearchResult{Title: getText(n), URL: target})
+				}
+			case n.Data == "td" && strings.Contains(class, " result-snippet ") && len(results) > 0:
+				if last := &results[len(results)-1]; last.Snippet == "" {
+					last.Snippet = strings.Join(strings.Fields(getText(n)), " ")
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			traverse(c)
+		}
+	}
+	traverse(doc)
+	return results
+}
+
+// duckDuckGoTarget returns the destination of a result link, unwrapping DuckDuckGo's
+// /l/?uddg= redirects.
+func duckDuckGoTarget(href string) string {
+	u, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+	if u.Path == "/l/" {
+		return u.Query().Get("uddg")
+	}
+	return href
+}
+
+func getText(n *html.Node) string {
+	var sb strings.Builder
+	var traverse func(*html.Node)
+	traverse = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			traverse(c)
+		}
+	}
+	traverse(n)
+	return strings.TrimSpace(sb.String())
+}
@@ -0,0 +1,116 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/EasterCompany/dex-web-service/utils"
+	"golang.org/x/net/html"
+)
+
+// TablesResponse holds the data tables of a page
+type TablesResponse struct {
+	URL    string        `json:"url"`
+	Format string        `json:"format"`
+	Tables []TableResult `json:"tables"`
+}
+
+// TableResult is one table with its rows as records (format=json) or CSV (format=csv)
+type TableResult struct {
+	utils.Table
+	Records []map[string]string `json:"records,omitempty"`
+	CSV     string              `json:"csv,omitempty"`
+}
+
+// TablesHandler extracts the data tables of a page, with spans resolved and header
+// rows turned into column names. table=N returns only the table with that index.
+func TablesHandler(w http.ResponseWriter, r *http.Request) {
+	targetURL := r.URL.Query().Get("url")
+	if targetURL == "" {
+		http.Error(w, "URL parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "":
+		format = "json"
+	case "json", "csv":
+	default:
+		http.Error(w, "Invalid format (expected json or csv)", http.StatusBadRequest)
+		return
+	}
+
+	index := -1
+	if v := r.URL.Query().Get("table"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "table must be a table index (0 or more)", http.StatusBadRequest)
+			return
+		}
+		index = n
+	}
+
+	ctx, err := cacheContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := fetchScrapePage(ctx, targetURL)
+	if errors.Is(err, errPageTooLarge) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	var doc *html.Node
+	if page.documentType != "" {
+		// DOCX, ODT and EPUB keep their tables when converted; PDFs have none to find
+		info, err := utils.ExtractDocument(page.documentType, []byte(page.body), utils.PageRange{})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to extract %s: %v", strings.ToUpper(page.documentType), err), http.StatusUnprocessableEntity)
+			return
+		}
+		extraction := info.Extraction(targetURL)
+		if extraction == nil {
+			http.Error(w, fmt.Sprintf("%s documents have no tables to extract", strings.ToUpper(page.documentType)), http.StatusUnprocessableEntity)
+			return
+		}
+		doc = extraction.Node
+	} else if doc, err = html.Parse(strings.NewReader(page.body)); err != nil {
+		http.Error(w, "Failed to parse HTML", http.StatusInternalServerError)
+		return
+	}
+
+	response := TablesResponse{URL: targetURL, Format: format, Tables: []TableResult{}}
+	for _, table := range utils.ExtractTables(doc) {
+		if index >= 0 && table.Index != index {
+			continue
+		}
+		result := TableResult{Table: table}
+		if format == "csv" {
+			result.CSV = table.CSV()
+		} else {
+			result.Records = table.Records()
+		}
+		response.Tables = append(response.Tables, result)
+	}
+	if index >= 0 && len(response.Tables) == 0 {
+		http.Error(w, fmt.Sprintf("No table with index %d", index), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding tables response: %v", err)
+	}
+}
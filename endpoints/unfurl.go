@@ -0,0 +1,270 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Discord embed limits, see https://discord.com/developers/docs/resources/message#embed-object-embed-limits
+const (
+	embedTitleLimit       = 256
+	embedDescriptionLimit = 4096
+	embedFieldCountLimit  = 25
+	embedFieldNameLimit   = 256
+	embedFieldValueLimit  = 1024
+	embedFooterLimit      = 2048
+	embedAuthorLimit      = 256
+	embedTotalLimit       = 6000
+)
+
+// largeImageWidth is the width from which an image is shown full size rather than as a thumbnail.
+const largeImageWidth = 400
+
+// DiscordEmbed is a ready-to-send Discord embed object.
+type DiscordEmbed struct {
+	Title       string              `json:"title,omitempty"`
+	Description string              `json:"description,omitempty"`
+	URL         string              `json:"url,omitempty"`
+	Timestamp   string              `json:"timestamp,omitempty"`
+	Color       *int                `json:"color,omitempty"`
+	Footer      *DiscordEmbedFooter `json:"footer,omitempty"`
+	Image       *DiscordEmbedMedia  `json:"image,omitempty"`
+	Thumbnail   *DiscordEmbedMedia  `json:"thumbnail,omitempty"`
+	Video       *DiscordEmbedMedia  `json:"video,omitempty"`
+	Provider    *DiscordEmbedLink   `json:"provider,omitempty"`
+	Author      *DiscordEmbedAuthor `json:"author,omitempty"`
+	Fields      []DiscordEmbedField `json:"fields,omitempty"`
+}
+
+type DiscordEmbedFooter struct {
+	Text    string `json:"text"`
+	IconURL string `json:"icon_url,omitempty"`
+}
+
+type DiscordEmbedMedia struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+}
+
+type DiscordEmbedLink struct {
+	Name string `json:"name,omitempty"`
+	URL  string `json:"url,omitempty"`
+}
+
+type DiscordEmbedAuthor struct {
+	Name    string `json:"name"`
+	URL     string `json:"url,omitempty"`
+	IconURL string `json:"icon_url,omitempty"`
+}
+
+type DiscordEmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+// UnfurlHandler fetches a URL's metadata and returns it as a Discord embed.
+func UnfurlHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	targetURL := r.URL.Query().Get("url")
+	if targetURL == "" {
+		http.Error(w, "URL parameter is required", http.StatusBadRequest)
+		return
+	}
+	ctx, err := cacheContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	metadata, err := fetchMetadata(ctx, targetURL)
+	if errors.Is(err, errInvalidURL) {
+		http.Error(w, "Invalid URL format", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(buildDiscordEmbed(metadata)); err != nil {
+		log.Printf("Error encoding unfurl response: %v", err)
+	}
+}
+
+// buildDiscordEmbed maps metadata onto an embed, applying Discord's length limits.
+func buildDiscordEmbed(m MetadataResponse) DiscordEmbed {
+	embed := DiscordEmbed{
+		URL:         m.URL,
+		Title:       truncateRunes(strings.TrimSpace(m.Title), embedTitleLimit),
+		Description: truncateRunes(strings.TrimSpace(m.Description), embedDescriptionLimit),
+	}
+
+	host := ""
+	if u, err := url.Parse(m.URL); err == nil {
+		host = strings.TrimPrefix(u.Hostname(), "www.")
+	}
+
+	// Thin pages: at least say where the link goes
+	if embed.Title == "" {
+		embed.Title = truncateRunes(strings.TrimPrefix(strings.TrimPrefix(m.URL, "https://"), "http://"), embedTitleLimit)
+	}
+
+	providerName := m.SiteName
+	if providerName == "" {
+		providerName = host
+	}
+	if providerName != "" {
+		embed.Provider = &DiscordEmbedLink{Name: providerName}
+		embed.Footer = &DiscordEmbedFooter{
+			Text:    truncateRunes(providerName, embedFooterLimit),
+			IconURL: m.IconURL,
+		}
+	}
+
+	if m.Author != "" {
+		embed.Author = &DiscordEmbedAuthor{Name: truncateRunes(m.Author, embedAuthorLimit)}
+	}
+
+	if color, ok := parseThemeColor(m.ThemeColor); ok {
+		embed.Color = &color
+	}
+
+	if ts, err := time.Parse(time.RFC3339, m.PublishedAt); err == nil {
+		embed.Timestamp = ts.UTC().Format(time.RFC3339)
+	}
+
+	if m.ImageURL != "" {
+		media := &DiscordEmbedMedia{URL: m.ImageURL}
+		large := m.Card == "summary_large_image"
+		if m.Image != nil {
+			media.Width = m.Image.Width
+			media.Height = m.Image.Height
+			if m.Image.Width >= largeImageWidth || m.Image.Animated {
+				large = true
+			}
+		}
+		if large {
+			embed.Image = media
+		} else {
+			embed.Thumbnail = media
+		}
+	}
+
+	if m.VideoURL != "" {
+		embed.Video = &DiscordEmbedMedia{URL: m.VideoURL}
+	}
+
+	for _, label := range m.Labels {
+		if len(embed.Fields) >= embedFieldCountLimit {
+			break
+		}
+		embed.Fields = append(embed.Fields, DiscordEmbedField{
+			Name:   truncateRunes(label.Label, embedFieldNameLimit),
+			Value:  truncateRunes(label.Data, embedFieldValueLimit),
+			Inline: true,
+		})
+	}
+
+	fitEmbedTotal(&embed)
+	return embed
+}
+
+// fitEmbedTotal keeps the combined text under Discord's 6000 character cap by
+// dropping fields first and then shortening the description.
+func fitEmbedTotal(embed *DiscordEmbed) {
+	total := func() int {
+		n := utf8.RuneCountInString(embed.Title) + utf8.RuneCountInString(embed.Description)
+		if embed.Footer != nil {
+			n += utf8.RuneCountInString(embed.Footer.Text)
+		}
+		if embed.Author != nil {
+			n += utf8.RuneCountInString(embed.Author.Name)
+		}
+		for _, f := range embed.Fields {
+			n += utf8.RuneCountInString(f.Name) + utf8.RuneCountInString(f.Value)
+		}
+		return n
+	}
+
+	for total() > embedTotalLimit && len(embed.Fields) > 0 {
+		embed.Fields = embed.Fields[:len(embed.Fields)-1]
+	}
+	if over := total() - embedTotalLimit; over > 0 {
+		keep := utf8.RuneCountInString(embed.Description) - over
+		embed.Description = truncateRunes(embed.Description, max(keep, 0))
+	}
+}
+
+// truncateRunes shortens s to at most limit runes, ending in an ellipsis when cut.
+func truncateRunes(s string, limit int) string {
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	if limit <= 1 {
+		return string([]rune(s)[:limit])
+	}
+	return strings.TrimSpace(string([]rune(s)[:limit-1])) + "…"
+}
+
+// parseThemeColor converts a CSS colour ("#abc", "#aabbcc", "rgb(1, 2, 3)") to Discord's integer form.
+func parseThemeColor(value string) (int, bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return 0, false
+	}
+
+	if strings.HasPrefix(value, "#") {
+		hex := value[1:]
+		if len(hex) == 3 || len(hex) == 4 {
+			hex = fmt.Sprintf("%c%c%c%c%c%c", hex[0], hex[0], hex[1], hex[1], hex[2], hex[2])
+		}
+		if len(hex) == 8 {
+			hex = hex[:6] // Discord has no alpha
+		}
+		if len(hex) != 6 {
+			return 0, false
+		}
+		n, err := strconv.ParseInt(hex, 16, 32)
+		if err != nil {
+			return 0, false
+		}
+		return int(n), true
+	}
+
+	if strings.HasPrefix(value, "rgb") {
+		start, end := strings.Index(value, "("), strings.Index(value, ")")
+		if start == -1 || end <= start {
+			return 0, false
+		}
+		parts := strings.FieldsFunc(value[start+1:end], func(r rune) bool { return r == ',' || r == ' ' || r == '/' })
+		if len(parts) < 3 {
+			return 0, false
+		}
+		color := 0
+		for _, part := range parts[:3] {
+			c, err := strconv.Atoi(part)
+			if err != nil || c < 0 || c > 255 {
+				return 0, false
+			}
+			color = color<<8 | c
+		}
+		return color, true
+	}
+
+	return 0, false
+}
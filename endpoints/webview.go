@@ -46,29 +46,14 @@ func WebViewHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
 	defer cancel()
 
-	// Initialize chromedp
-	// We use the default allocator which tries to find Chrome/Chromium.
-	// If it fails to find a browser, it will return an error during Run.
-	ctx, cancel = chromedp.NewContext(ctx)
-	defer cancel()
-
-	var title, content string
 	var buf []byte
 	var pageHeight float64
 
-	// Run tasks
-	// 1. Emulate Mobile (iPhone X width)
-	// 2. Navigate & Wait
-	// 3. Capture Meta
-	// 4. Measure Height
-	// 5. Resize Viewport to content height (capped at 5000px)
-	// 6. Capture Screenshot
-	err := chromedp.Run(ctx,
-		chromedp.EmulateViewport(375, 812, chromedp.EmulateMobile),
-		chromedp.Navigate(targetURL),
-		chromedp.WaitVisible(`body`, chromedp.ByQuery),
-		chromedp.Title(&title),
-		chromedp.OuterHTML(`html`, &content, chromedp.ByQuery),
+	// After loading:
+	// 1. Measure Height
+	// 2. Resize Viewport to content height (capped at 5000px)
+	// 3. Capture Screenshot
+	page, err := renderPage(ctx, targetURL, false,
 		chromedp.Evaluate(`document.documentElement.scrollHeight`, &pageHeight),
 		chromedp.ActionFunc(func(ctx context.Context) error {
 			h := int64(pageHeight)
@@ -91,11 +76,11 @@ func WebViewHandler(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Chromedp error for %s: %v", targetURL, err)
 		response.Error = fmt.Sprintf("Failed to browse page: %v", err)
 	} else {
-		response.Title = title
-		response.Content = content
+		response.Title = page.title
+		response.Content = page.content
 
-		if shouldSummarize && content != "" {
-			response.Summary, _ = utils.GenerateSummary(content)
+		if shouldSummarize && page.content != "" {
+			response.Summary, _ = utils.GenerateSummary(page.content)
 		}
 
 		if outputPath != "" {
@@ -119,3 +104,46 @@ func WebViewHandler(w http.ResponseWriter, r *http.Request) {
 	// Update global Web View state
 	go utils.UpdateWebViewState(context.Background(), utils.GetRedisClient(), targetURL, "visual", response)
 }
+
+// renderedPage is a page as loaded in headless Chrome.
+type renderedPage struct {
+	title   string
+	content string // Rendered HTML
+}
+
+// renderPage loads targetURL in headless Chrome and captures its title and DOM. With
+// settle it also waits for the load event and gives scripts a moment to render first,
+// as /scrape needs. Extra actions run in the same tab afterwards.
+func renderPage(ctx context.Context, targetURL string, settle bool, extra ...chromedp.Action) (renderedPage, error) {
+	// Initialize chromedp
+	// We use the default allocator which tries to find Chrome/Chromium.
+	// If it fails to find a browser, it will return an error during Run.
+	ctx, cancel := chromedp.NewContext(ctx)
+	defer cancel()
+
+	// Run tasks
+	// 1. Emulate Mobile (iPhone X width)
+	// 2. Navigate & Wait
+	// 3. Capture Meta
+	var page renderedPage
+	actions := []chromedp.Action{
+		chromedp.EmulateViewport(375, 812, chromedp.EmulateMobile),
+		chromedp.Navigate(targetURL),
+		chromedp.WaitVisible(`body`, chromedp.ByQuery),
+	}
+	if settle {
+		actions = append(actions,
+			chromedp.Poll(`document.readyState === "complete"`, nil),
+			chromedp.Sleep(renderSettleDelay),
+		)
+	}
+	actions = append(actions,
+		chromedp.Title(&page.title),
+		chromedp.OuterHTML(`html`, &page.content, chromedp.ByQuery),
+	)
+	err := chromedp.Run(ctx, append(actions, extra...)...)
+	return page, err
+}
+
+// renderSettleDelay is how long rendering waits after the load event for client-side rendering
+const renderSettleDelay = 500 * time.Millisecond
@@ -97,12 +97,18 @@ func main() {
 	mux.HandleFunc("/service", endpoints.ServiceHandler)
 	// /metadata endpoint for link unfurling and content extraction
 	mux.HandleFunc("/metadata", endpoints.MetadataHandler)
+	// /metadata/batch endpoint for unfurling many links in one call
+	mux.HandleFunc("/metadata/batch", endpoints.MetadataBatchHandler)
+	// /unfurl endpoint for ready-to-send Discord embeds
+	mux.HandleFunc("/unfurl", endpoints.UnfurlHandler)
 	// /webview endpoint for headless browser rendering
 	mux.HandleFunc("/webview", endpoints.WebViewHandler)
-	// /search endpoint for DuckDuckGo HTML search
+	// /search endpoint for web search, falling back across providers
 	mux.HandleFunc("/search", endpoints.SearchHandler)
 	// /scrape endpoint for full content extraction
 	mux.HandleFunc("/scrape", endpoints.ScrapeHandler)
+	// /tables endpoint for data tables as JSON records or CSV
+	mux.HandleFunc("/tables", endpoints.TablesHandler)
 	// /open endpoint for protocol redirects (ssh, mosh, etc.)
 	mux.HandleFunc("/open", endpoints.OpenHandler)
 
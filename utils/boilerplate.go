@@ -0,0 +1,232 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/net/html"
+)
+
+// Boilerplate learning: blocks whose fingerprint turns up on most distinct pages of a
+// site are site chrome (cookie bars, footers, "follow us" boxes) and are removed before
+// extraction. Counts decay, so a redesigned site forgets its old template.
+const (
+	boilerplateHalfLife      = 14 * 24 * time.Hour // Weight of a sighting halves over this period
+	boilerplateTTL           = 60 * 24 * time.Hour // Sites not seen for this long are forgotten
+	boilerplateMinPages      = 5                   // Distinct pages needed before anything is removed
+	boilerplateMinRatio      = 0.6                 // Share of pages a block must appear on
+	boilerplateMaxBlocks     = 400                 // Blocks fingerprinted per page
+	boilerplateMaxEntries    = 20000               // Fingerprints kept per site before pruning
+	boilerplateMaxURLs       = 10000               // Page URLs remembered per site for de-duplication
+	boilerplateMinText       = 20                  // Shorter blocks are too generic to learn from
+	boilerplateMaxText       = 5000                // Longer blocks are content, not chrome
+	boilerplateTextShare     = 0.5                 // Blocks holding more of the page text are never removed
+	boilerplatePagesField    = "_pages"
+	boilerplateLookupTimeout = 500 * time.Millisecond
+)
+
+// learnBoilerplateScript records one page's fingerprints, once per URL. Each hash field
+// holds "weight:unix", the weight decayed to that time.
+var learnBoilerplateScript = redis.NewScript(`
+if redis.call('SADD', KEYS[2], ARGV[3]) == 0 then
+	return 0
+end
+if redis.call('SCARD', KEYS[2]) > tonumber(ARGV[6]) then
+	redis.call('DEL', KEYS[2])
+end
+redis.call('EXPIRE', KEYS[2], ARGV[4])
+
+local now = tonumber(ARGV[1])
+local halfLife = tonumber(ARGV[2])
+local function decayed(value)
+	if not value then
+		return 0
+	end
+	local weight, at = string.match(value, '([^:]+):([^:]+)')
+	return tonumber(weight) * math.pow(0.5, (now - tonumber(at)) / halfLife)
+end
+
+for i = 7, #ARGV do
+	local weight = decayed(redis.call('HGET', KEYS[1], ARGV[i])) + 1
+	redis.call('HSET', KEYS[1], ARGV[i], string.format('%.4f:%d', weight, now))
+end
+redis.call('EXPIRE', KEYS[1], ARGV[4])
+
+if redis.call('HLEN', KEYS[1]) > tonumber(ARGV[5]) then
+	local all = redis.call('HGETALL', KEYS[1])
+	for i = 1, #all, 2 do
+		if all[i] ~= '_pages' and decayed(all[i + 1]) < 1 then
+			redis.call('HDEL', KEYS[1], all[i])
+		end
+	end
+end
+return 1
+`)
+
+// boilerplateBlock is a fingerprinted element of a page.
+type boilerplateBlock struct {
+	node        *html.Node
+	fingerprint string
+	textLength  int
+}
+
+// fingerprintBlocks fingerprints the block elements of doc by tag and normalised text.
+func fingerprintBlocks(doc *html.Node) []boilerplateBlock {
+	var blocks []boilerplateBlock
+	seen := make(map[string]bool)
+	for _, n := range findAll(doc, "div", "section", "aside", "nav", "header", "footer", "ul", "ol", "form", "p", "table", "dl", "figure") {
+		if len(blocks) >= boilerplateMaxBlocks {
+			break
+		}
+		text := normalizeBoilerplateText(innerText(n))
+		if len(text) < boilerplateMinText || len(text) > boilerplateMaxText {
+			continue
+		}
+		sum := sha256.Sum256([]byte(n.Data + "|" + text))
+		fingerprint := fmt.Sprintf("%x", sum[:8])
+		if seen[fingerprint] {
+			continue
+		}
+		seen[fingerprint] = true
+		blocks = append(blocks, boilerplateBlock{node: n, fingerprint: fingerprint, textLength: len(text)})
+	}
+	return blocks
+}
+
+// normalizeBoilerplateText lowercases text and masks digits, so counters and dates
+// in otherwise identical chrome don't change the fingerprint.
+func normalizeBoilerplateText(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return '0'
+		}
+		return r
+	}, strings.ToLower(text))
+}
+
+// learnedBoilerplate returns the elements of doc that are known boilerplate for the
+// page's site, then records the page's blocks towards future lookups in the background.
+// Without Redis it returns nothing.
+func learnedBoilerplate(doc *html.Node, pageURL string) map[*html.Node]bool {
+	host := boilerplateHost(pageURL)
+	if RDB == nil || host == "" {
+		return nil
+	}
+	blocks := fingerprintBlocks(doc)
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	defer func() { go learnBoilerplate(host, pageURL, blocks) }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), boilerplateLookupTimeout)
+	defer cancel()
+
+	fields := []string{boilerplatePagesField}
+	for _, b := range blocks {
+		fields = append(fields, b.fingerprint)
+	}
+	values, err := RDB.HMGet(ctx, boilerplateKey(host), fields...).Result()
+	if err != nil {
+		return nil
+	}
+
+	now := time.Now()
+	pages := decayedWeight(values[0], now)
+	if pages < boilerplateMinPages {
+		return nil
+	}
+
+	bodyText := 0
+	if body := findBody(doc); body != nil {
+		bodyText = len(innerText(body))
+	}
+
+	found := make(map[*html.Node]bool)
+	for i, b := range blocks {
+		if decayedWeight(values[i+1], now)/pages < boilerplateMinRatio {
+			continue
+		}
+		// Never remove the bulk of the page, however often it recurs
+		if bodyText > 0 && float64(b.textLength) > boilerplateTextShare*float64(bodyText) {
+			continue
+		}
+		found[b.node] = true
+	}
+	return found
+}
+
+func learnBoilerplate(host, pageURL string, blocks []boilerplateBlock) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	urlSum := sha256.Sum256([]byte(pageURL))
+	args := []interface{}{
+		time.Now().Unix(),
+		int64(boilerplateHalfLife.Seconds()),
+		fmt.Sprintf("%x", urlSum[:8]),
+		int64(boilerplateTTL.Seconds()),
+		boilerplateMaxEntries,
+		boilerplateMaxURLs,
+		boilerplatePagesField,
+	}
+	for _, b := range blocks {
+		args = append(args, b.fingerprint)
+	}
+
+	keys := []string{boilerplateKey(host), boilerplateKey(host) + ":urls"}
+	if err := learnBoilerplateScript.Run(ctx, RDB, keys, args...).Err(); err != nil {
+		log.Printf("Failed to record boilerplate for %s: %v", host, err)
+	}
+}
+
+// decayedWeight parses a "weight:unix" value and decays it to now.
+func decayedWeight(value interface{}, now time.Time) float64 {
+	s, ok := value.(string)
+	if !ok {
+		return 0
+	}
+	weightStr, atStr, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0
+	}
+	weight, err1 := strconv.ParseFloat(weightStr, 64)
+	at, err2 := strconv.ParseInt(atStr, 10, 64)
+	if err1 != nil || err2 != nil {
+		return 0
+	}
+	age := now.Sub(time.Unix(at, 0))
+	return weight * math.Pow(0.5, age.Seconds()/boilerplateHalfLife.Seconds())
+}
+
+func boilerplateHost(pageURL string) string {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+func boilerplateKey(host string) string {
+	return "web:boilerplate:" + host
+}
+
+// removeCopies detaches every copied node whose original is in originals.
+func removeCopies(origins map[*html.Node]*html.Node, originals map[*html.Node]bool) {
+	if len(originals) == 0 {
+		return
+	}
+	for copied, orig := range origins {
+		if originals[orig] && copied.Parent != nil {
+			copied.Parent.RemoveChild(copied)
+		}
+	}
+}
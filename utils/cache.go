@@ -16,10 +16,26 @@ func GetRedisClient() *redis.Client {
 	return RDB
 }
 
+type cacheBypassKey struct{}
+
+// WithCacheBypass returns a context in which cache reads miss. Whatever is fetched
+// instead is still written back, so a bypass also refreshes the cached copy.
+func WithCacheBypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cacheBypassKey{}, true)
+}
+
+func cacheBypassed(ctx context.Context) bool {
+	bypass, _ := ctx.Value(cacheBypassKey{}).(bool)
+	return bypass
+}
+
 func GetWebViewCache(ctx context.Context, targetURL string) (string, error) {
 	if RDB == nil {
 		return "", fmt.Errorf("redis not initialized")
 	}
+	if cacheBypassed(ctx) {
+		return "", redis.Nil
+	}
 
 	key := fmt.Sprintf("web:cache:%x", sha256.Sum256([]byte(targetURL)))
 	return RDB.Get(ctx, key).Result()
@@ -33,3 +49,25 @@ func SetWebViewCache(ctx context.Context, targetURL string, content string) erro
 	key := fmt.Sprintf("web:cache:%x", sha256.Sum256([]byte(targetURL)))
 	return RDB.Set(ctx, key, content, 10*time.Minute).Err()
 }
+
+// GetSearchCache returns the cached results stored under a normalized search key.
+func GetSearchCache(ctx context.Context, searchKey string) (string, error) {
+	if RDB == nil {
+		return "", fmt.Errorf("redis not initialized")
+	}
+	if cacheBypassed(ctx) {
+		return "", redis.Nil
+	}
+
+	key := fmt.Sprintf("web:search:%x", sha256.Sum256([]byte(searchKey)))
+	return RDB.Get(ctx, key).Result()
+}
+
+func SetSearchCache(ctx context.Context, searchKey string, content string, ttl time.Duration) error {
+	if RDB == nil {
+		return fmt.Errorf("redis not initialized")
+	}
+
+	key := fmt.Sprintf("web:search:%x", sha256.Sum256([]byte(searchKey)))
+	return RDB.Set(ctx, key, content, ttl).Err()
+}
@@ -0,0 +1,388 @@
+package utils
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Chunk is a piece of Markdown sized for an LLM context, cut at block boundaries.
+type Chunk struct {
+	Index       int      `json:"index"`
+	Text        string   `json:"text"`
+	HeadingPath []string `json:"heading_path,omitempty"` // Enclosing headings, outermost first
+	Start       int      `json:"start"`                  // Character offsets into the full content
+	End         int      `json:"end"`
+	Tokens      int      `json:"tokens"` // As counted by the estimator in use
+}
+
+// TokenEstimator approximates how many tokens a model's tokenizer would produce for text.
+type TokenEstimator interface {
+	EstimateTokens(text string) int
+}
+
+// TokenEstimatorFunc adapts a plain function to TokenEstimator.
+type TokenEstimatorFunc func(text string) int
+
+// EstimateTokens calls f(text).
+func (f TokenEstimatorFunc) EstimateTokens(text string) int {
+	return f(text)
+}
+
+// DefaultTokenEstimator is used when a caller doesn't name one.
+const DefaultTokenEstimator = "approx"
+
+var (
+	tokenEstimatorsMu sync.RWMutex
+	tokenEstimators   = map[string]TokenEstimator{
+		"approx": TokenEstimatorFunc(approxTokens),
+		"words":  TokenEstimatorFunc(func(text string) int { return int(math.Ceil(float64(len(strings.Fields(text))) * 4 / 3)) }),
+		"chars":  TokenEstimatorFunc(func(text string) int { return (utf8.RuneCountInString(text) + 3) / 4 }),
+	}
+)
+
+// RegisterTokenEstimator makes an estimator available by name, replacing any existing one.
+func RegisterTokenEstimator(name string, estimator TokenEstimator) {
+	tokenEstimatorsMu.Lock()
+	defer tokenEstimatorsMu.Unlock()
+	tokenEstimators[name] = estimator
+}
+
+// GetTokenEstimator returns the estimator registered under name.
+func GetTokenEstimator(name string) (TokenEstimator, bool) {
+	tokenEstimatorsMu.RLock()
+	defer tokenEstimatorsMu.RUnlock()
+	estimator, ok := tokenEstimators[name]
+	return estimator, ok
+}
+
+// approxTokens mimics a BPE tokenizer: about four characters per token within a word,
+// one token per CJK character and one per punctuation mark.
+func approxTokens(text string) int {
+	tokens, word := 0, 0
+	endWord := func() {
+		tokens += (word + 3) / 4
+		word = 0
+	}
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			endWord()
+			tokens++
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word++
+		case unicode.IsSpace(r):
+			endWord()
+		default:
+			endWord()
+			tokens++
+		}
+	}
+	endWord()
+	return tokens
+}
+
+var (
+	reMarkdownHeading = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	reSentenceBreak   = regexp.MustCompile(`[.!?…。！？]["'”’)\]]*\s+`)
+	reMarkdownEscape  = regexp.MustCompile(`\\(.)`)
+)
+
+// mdBlock is a span of Markdown that chunking keeps together when it can.
+type mdBlock struct {
+	start, end int // Byte offsets
+	kind       string
+	level      int // Heading level
+	path       []string
+}
+
+// span is a byte range of the content, the unit chunks are built from.
+type span struct {
+	start, end int
+	tokens     int
+	heading    bool
+	path       []string
+}
+
+// ChunkMarkdown splits md into chunks of at most maxTokens tokens (by estimator),
+// cutting between headings, paragraphs, lists, code blocks and tables. A block too big
+// for one chunk is cut between sentences, or lines for code and tables. A heading is
+// never left at the end of a chunk (so a chunk can run over when the first sentence
+// after it doesn't fit), and a new section starts a new chunk once the current one is
+// half full. Each chunk after the first repeats up to overlap tokens of
+// the previous one, except at section starts. Chunk text is always a slice of md.
+func ChunkMarkdown(md string, maxTokens, overlap int, estimator TokenEstimator) []Chunk {
+	if maxTokens <= 0 || strings.TrimSpace(md) == "" {
+		return nil
+	}
+	if overlap < 0 || overlap >= maxTokens {
+		overlap = 0
+	}
+	count := func(start, end int) int {
+		return estimator.EstimateTokens(md[start:end])
+	}
+
+	var chunks []Chunk
+	var current []span
+	currentTokens := 0
+
+	emit := func(spans []span) {
+		if len(spans) == 0 {
+			return
+		}
+		start, end := spans[0].start, spans[len(spans)-1].end
+		chunks = append(chunks, Chunk{
+			Index:       len(chunks),
+			Text:        md[start:end],
+			HeadingPath: spans[0].path,
+			Start:       utf8.RuneCountInString(md[:start]),
+			End:         utf8.RuneCountInString(md[:end]),
+			Tokens:      count(start, end),
+		})
+	}
+
+	// flush emits the current chunk and starts the next one with the trailing
+	// headings, or else the overlap, carried over
+	flush := func(withOverlap bool) {
+		keep := len(current)
+		for keep > 0 && current[keep-1].heading {
+			keep--
+		}
+		if keep == 0 {
+			return // Only headings so far; let them gather content first
+		}
+		emit(current[:keep])
+
+		var next []span
+		if keep < len(current) {
+			next = append(next, current[keep:]...)
+		} else if withOverlap && overlap > 0 {
+			budget := 0
+			first := keep
+			for first > 0 && budget+current[first-1].tokens <= overlap {
+				first--
+				budget += current[first].tokens
+			}
+			if first > 0 && first < keep { // Never repeat the whole chunk
+				next = append(next, current[first:keep]...)
+			}
+		}
+		current = next
+		currentTokens = 0
+		for _, s := range current {
+			currentTokens += s.tokens
+		}
+	}
+
+	add := func(s span) {
+		current = append(current, s)
+		currentTokens += s.tokens
+	}
+
+	for _, block := range splitMarkdownBlocks(md) {
+		tokens := count(block.start, block.end)
+		whole := span{start: block.start, end: block.end, tokens: tokens, heading: block.kind == "heading", path: block.path}
+
+		if whole.heading && currentTokens*2 >= maxTokens {
+			flush(false)
+		}
+		if currentTokens+tokens <= maxTokens {
+			add(whole)
+			continue
+		}
+		if tokens <= maxTokens {
+			flush(true)
+			for len(current) > 0 && currentTokens+tokens > maxTokens && !current[0].heading {
+				currentTokens -= current[0].tokens
+				current = current[1:]
+			}
+			if currentTokens+tokens <= maxTokens {
+				add(whole)
+				continue
+			}
+		}
+
+		// Too big for the chunk, even after the headings it follows: cut it into sentences or lines
+		for _, piece := range splitBlock(md, block, maxTokens, count) {
+			if currentTokens+piece.tokens > maxTokens && currentTokens > 0 {
+				flush(true)
+				for len(current) > 0 && currentTokens+piece.tokens > maxTokens && !current[0].heading {
+					currentTokens -= current[0].tokens
+					current = current[1:]
+				}
+			}
+			add(piece)
+		}
+	}
+
+	for len(current) > 0 && current[len(current)-1].heading {
+		current = current[:len(current)-1] // A trailing heading has nothing to introduce
+	}
+	emit(current)
+	return chunks
+}
+
+// splitMarkdownBlocks cuts md into headings, fenced code blocks, tables and
+// blank-line separated blocks, recording the heading path of each.
+func splitMarkdownBlocks(md string) []mdBlock {
+	var blocks []mdBlock
+	var headings []mdBlock // Open headings, outermost first
+	pathOf := func() []string {
+		var path []string
+		for _, h := range headings {
+			path = append(path, h.path[len(h.path)-1])
+		}
+		return path
+	}
+
+	var open *mdBlock
+	closeBlock := func() {
+		if open != nil {
+			open.path = pathOf()
+			blocks = append(blocks, *open)
+			open = nil
+		}
+	}
+
+	fence := ""
+	for offset := 0; offset < len(md); {
+		lineEnd := strings.IndexByte(md[offset:], '\n')
+		if lineEnd < 0 {
+			lineEnd = len(md)
+		} else {
+			lineEnd += offset
+		}
+		line := md[offset:lineEnd]
+		trimmed := strings.TrimSpace(line)
+		next := lineEnd + 1
+
+		switch {
+		case fence != "":
+			open.end = lineEnd
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				fence = ""
+				closeBlock()
+			}
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			closeBlock()
+			fence = trimmed[:3]
+			for len(fence) < len(trimmed) && trimmed[len(fence)] == fence[0] {
+				fence += fence[:1]
+			}
+			open = &mdBlock{start: offset, end: lineEnd, kind: "code"}
+		case trimmed == "":
+			closeBlock()
+		case reMarkdownHeading.MatchString(line):
+			closeBlock()
+			m := reMarkdownHeading.FindStringSubmatch(line)
+			level := len(m[1])
+			for len(headings) > 0 && headings[len(headings)-1].level >= level {
+				headings = headings[:len(headings)-1]
+			}
+			headings = append(headings, mdBlock{level: level, path: []string{reMarkdownEscape.ReplaceAllString(m[2], "$1")}})
+			blocks = append(blocks, mdBlock{start: offset, end: lineEnd, kind: "heading", level: level, path: pathOf()})
+		case strings.HasPrefix(trimmed, "|"):
+			if open != nil && open.kind != "table" {
+				closeBlock()
+			}
+			if open == nil {
+				open = &mdBlock{start: offset, kind: "table"}
+			}
+			open.end = lineEnd
+		default:
+			if open != nil && open.kind == "table" {
+				closeBlock()
+			}
+			if open == nil {
+				open = &mdBlock{start: offset, kind: "text"}
+			}
+			open.end = lineEnd
+		}
+		offset = next
+	}
+	closeBlock()
+	return blocks
+}
+
+// splitBlock cuts an oversized block into spans that fit maxTokens where possible:
+// lines for code, tables and lists, sentences for prose, and words as a last resort.
+func splitBlock(md string, block mdBlock, maxTokens int, count func(int, int) int) []span {
+	var cuts []int // Offsets where a new span may begin
+	text := md[block.start:block.end]
+	if block.kind == "code" || block.kind == "table" || strings.Contains(text, "\n") {
+		for i := 0; i < len(text)-1; i++ {
+			if text[i] == '\n' {
+				cuts = append(cuts, block.start+i+1)
+			}
+		}
+	}
+	if block.kind == "text" {
+		for _, loc := range reSentenceBreak.FindAllStringIndex(text, -1) {
+			cuts = append(cuts, block.start+loc[1])
+		}
+	}
+	cuts = sortedUnique(append(cuts, block.start, block.end))
+
+	var spans []span
+	for i := 0; i+1 < len(cuts); i++ {
+		start, end := cuts[i], cuts[i+1]
+		// Trailing whitespace belongs to no chunk
+		for end > start && (md[end-1] == ' ' || md[end-1] == '\n') {
+			end--
+		}
+		if end <= start {
+			continue
+		}
+		tokens := count(start, end)
+		if tokens <= maxTokens {
+			spans = append(spans, span{start: start, end: end, tokens: tokens, path: block.path})
+			continue
+		}
+		spans = append(spans, splitWords(md, start, end, maxTokens, count, block.path)...)
+	}
+	return spans
+}
+
+// splitWords cuts md[start:end] at spaces into spans of at most maxTokens tokens. The
+// span is tallied word by word, which the estimators round up, and only recounted whole
+// once the tally runs over, so a long unbroken paragraph costs about linear time.
+func splitWords(md string, start, end, maxTokens int, count func(int, int) int, path []string) []span {
+	var spans []span
+	spanStart, lastGood := start, -1
+	tokens := 0 // Tally for md[spanStart:lastGood]
+	for i := start; i <= end; i++ {
+		if i < end && md[i] != ' ' {
+			continue
+		}
+		next := tokens + count(max(lastGood, spanStart), i)
+		if next > maxTokens {
+			next = count(spanStart, i)
+		}
+		if next > maxTokens && lastGood > spanStart {
+			spans = append(spans, span{start: spanStart, end: lastGood, tokens: count(spanStart, lastGood), path: path})
+			spanStart = lastGood + 1
+			next = count(spanStart, i)
+		}
+		tokens = next
+		lastGood = i
+	}
+	if spanStart < end {
+		spans = append(spans, span{start: spanStart, end: end, tokens: count(spanStart, end), path: path})
+	}
+	return spans
+}
+
+func sortedUnique(values []int) []int {
+	sort.Ints(values)
+	unique := values[:0]
+	for i, v := range values {
+		if i == 0 || v != values[i-1] {
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,161 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// DocumentInfo is the text and metadata of a non-HTML document: a PDF, DOCX, ODT or EPUB.
+type DocumentInfo struct {
+	Type      string         `json:"type"` // "pdf", "docx", "odt" or "epub"
+	Title     string         `json:"title,omitempty"`
+	Author    string         `json:"author,omitempty"`
+	Subject   string         `json:"subject,omitempty"`
+	Created   string         `json:"created,omitempty"` // RFC 3339 when the document's date parses
+	Modified  string         `json:"modified,omitempty"`
+	PageCount int            `json:"page_count,omitempty"` // PDF pages or EPUB chapters
+	Pages     []DocumentPage `json:"pages,omitempty"`      // Only the pages that were asked for
+
+	content *html.Node // DOCX, ODT and EPUB converted to HTML; PDFs are plain text
+}
+
+// DocumentPage is the text of one page (or chapter) of a document.
+type DocumentPage struct {
+	Number int    `json:"number"` // 1-based
+	Title  string `json:"title,omitempty"`
+	Text   string `json:"text"`
+}
+
+// Extraction returns a converted DOCX, ODT or EPUB as an Extraction, so it renders
+// like a web page. PDFs have no markup and return nil.
+func (d *DocumentInfo) Extraction(pageURL string) *Extraction {
+	if d.content == nil {
+		return nil
+	}
+	published := d.Created
+	if published == "" {
+		published = d.Modified
+	}
+	return &Extraction{
+		Node:      d.content,
+		PageURL:   pageURL,
+		Title:     d.Title,
+		Author:    d.Author,
+		Published: published,
+		sources:   []pageSource{{d.content, pageURL}},
+	}
+}
+
+// Text joins the text of all extracted pages with paragraph breaks.
+func (d *DocumentInfo) Text() string {
+	var parts []string
+	for _, p := range d.Pages {
+		if text := strings.TrimSpace(p.Text); text != "" {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// HTML renders the pages as sections of escaped paragraphs.
+func (d *DocumentInfo) HTML() string {
+	var b strings.Builder
+	for _, p := range d.Pages {
+		fmt.Fprintf(&b, "<section data-page=\"%d\">\n", p.Number)
+		for _, para := range strings.Split(p.Text, "\n\n") {
+			if para = strings.TrimSpace(para); para != "" {
+				b.WriteString("<p>" + strings.ReplaceAll(html.EscapeString(para), "\n", "<br>\n") + "</p>\n")
+			}
+		}
+		b.WriteString("</section>\n")
+	}
+	return b.String()
+}
+
+// ExtractDocument extracts a document of a type returned by DetectDocumentType.
+func ExtractDocument(docType string, data []byte, pages PageRange) (*DocumentInfo, error) {
+	switch docType {
+	case "pdf":
+		return ExtractPDF(data, pages)
+	case "docx":
+		return extractDOCX(data)
+	case "odt":
+		return extractODT(data)
+	case "epub":
+		return extractEPUB(data, pages)
+	}
+	return nil, fmt.Errorf("unsupported document type %q", docType)
+}
+
+// Content types of the documents /scrape extracts
+var documentContentTypes = map[string]string{
+	"application/pdf": "pdf",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": "docx",
+	"application/vnd.oasis.opendocument.text":                                 "odt",
+	"application/epub+zip":                                                    "epub",
+}
+
+// DetectDocumentType returns the document type of a response body from its Content-Type
+// or, failing that, its contents: "pdf", "docx", "odt", "epub", or "" for anything else.
+func DetectDocumentType(contentType string, body []byte) string {
+	mediaType, _, _ := strings.Cut(strings.ToLower(contentType), ";")
+	if docType, ok := documentContentTypes[strings.TrimSpace(mediaType)]; ok {
+		return docType
+	}
+	switch {
+	case bytes.HasPrefix(body, []byte("%PDF-")):
+		return "pdf"
+	case bytes.HasPrefix(body, []byte("PK\x03\x04")):
+		return zipDocumentType(body)
+	}
+	return ""
+}
+
+// PageRange is a set of 1-based page numbers, e.g. "1-3,7,10-". The zero value means every page.
+type PageRange struct {
+	spans [][2]int // Inclusive; an end of 0 means open-ended
+}
+
+// ParsePageRange parses a comma-separated list of pages and ranges.
+func ParsePageRange(s string) (PageRange, error) {
+	var r PageRange
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(strings.TrimSpace(from))
+		if err != nil || start < 1 {
+			return r, fmt.Errorf("invalid page range %q", part)
+		}
+		end := start
+		if isRange {
+			end = 0
+			if to = strings.TrimSpace(to); to != "" {
+				if end, err = strconv.Atoi(to); err != nil || end < start {
+					return r, fmt.Errorf("invalid page range %q", part)
+				}
+			}
+		}
+		r.spans = append(r.spans, [2]int{start, end})
+	}
+	return r, nil
+}
+
+// Contains reports whether page n is in the range.
+func (r PageRange) Contains(n int) bool {
+	if len(r.spans) == 0 {
+		return true
+	}
+	for _, span := range r.spans {
+		if n >= span[0] && (span[1] == 0 || n <= span[1]) {
+			return true
+		}
+	}
+	return false
+}
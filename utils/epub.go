@@ -0,0 +1,184 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Elements dropped from EPUB chapters: navigation and images that can't be shown
+var epubDroppedTags = map[string]bool{"nav": true, "img": true, "svg": true, "image": true}
+
+// extractEPUB reads an EPUB's package document and converts the chapters of its spine
+// that are in pages. Each spine document counts as one page.
+func extractEPUB(data []byte, pages PageRange) (*DocumentInfo, error) {
+	zr, err := openZipDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	container, err := readZipXML(zr, "META-INF/container.xml")
+	if err != nil {
+		return nil, err
+	}
+	opfPath := container.find("rootfile").attr("full-path")
+	if opfPath == "" {
+		return nil, fmt.Errorf("%w: no package document", ErrDocumentMalformed)
+	}
+	opf, err := readZipXML(zr, opfPath)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &DocumentInfo{Type: "epub"}
+	metadata := opf.find("metadata")
+	info.Title = strings.TrimSpace(metadata.find("title").textContent())
+	var authors []string
+	for _, creator := range metadata.findAll("creator") {
+		if name := strings.TrimSpace(creator.textContent()); name != "" {
+			authors = append(authors, name)
+		}
+	}
+	info.Author = strings.Join(authors, ", ")
+	info.Subject = strings.TrimSpace(metadata.find("description").textContent())
+	info.Created = strings.TrimSpace(metadata.find("date").textContent())
+	for _, meta := range metadata.findAll("meta") {
+		if meta.attr("property") == "dcterms:modified" {
+			info.Modified = strings.TrimSpace(meta.textContent())
+		}
+	}
+
+	manifest := make(map[string]*xmlNode)
+	for _, item := range opf.find("manifest").findAll("item") {
+		manifest[item.attr("id")] = item
+	}
+
+	article := newElement("article", atom.Article)
+	base := path.Dir(opfPath)
+	for _, ref := range opf.find("spine").findAll("itemref") {
+		item := manifest[ref.attr("idref")]
+		if item == nil || !strings.Contains(item.attr("media-type"), "html") || ref.attr("linear") == "no" {
+			continue
+		}
+		info.PageCount++
+		if !pages.Contains(info.PageCount) {
+			continue
+		}
+
+		href, err := url.PathUnescape(item.attr("href"))
+		if err != nil {
+			href = item.attr("href")
+		}
+		raw, err := readZipPart(zr, path.Join(base, href))
+		if err != nil {
+			continue // A missing chapter shouldn't lose the rest of the book
+		}
+		section, title := epubChapter(raw)
+		if section == nil {
+			continue
+		}
+		article.AppendChild(section)
+		info.Pages = append(info.Pages, DocumentPage{Number: info.PageCount, Title: title, Text: nodeToText(section)})
+	}
+	if info.PageCount == 0 {
+		return nil, fmt.Errorf("%w: empty spine", ErrDocumentMalformed)
+	}
+	info.content = article
+	return info, nil
+}
+
+// epubChapter converts a chapter's XHTML body into a section, returning it with the
+// chapter's title: its first heading, else the document title.
+func epubChapter(raw []byte) (*html.Node, string) {
+	// Chapters are XHTML, where <a id="x"/> is complete; the HTML parser would leave it open
+	var doc *html.Node
+	if tree, err := parseXMLTree(raw); err == nil && tree.find("body") != nil {
+		doc = xmlToHTML(tree.find("html"))
+	}
+	if doc == nil {
+		var err error
+		if doc, err = html.Parse(bytes.NewReader(raw)); err != nil {
+			return nil, ""
+		}
+	}
+	body := findBody(doc)
+	if body == nil {
+		return nil, ""
+	}
+
+	section := newElement("section", atom.Section)
+	for c := body.FirstChild; c != nil; {
+		next := c.NextSibling
+		body.RemoveChild(c)
+		section.AppendChild(c)
+		c = next
+	}
+	removeNonContent(section)
+	cleanEPUBChapter(section)
+
+	title := ""
+	if headings := findAll(section, "h1", "h2", "h3"); len(headings) > 0 {
+		title = innerText(headings[0])
+	} else if titles := findAll(doc, "title"); len(titles) > 0 {
+		title = innerText(titles[0])
+	}
+	return section, title
+}
+
+// cleanEPUBChapter drops navigation and images and unwraps links into the book itself,
+// which mean nothing outside the EPUB.
+func cleanEPUBChapter(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.ElementNode {
+			cleanEPUBChapter(c)
+			switch {
+			case epubDroppedTags[c.Data]:
+				n.RemoveChild(c)
+			case c.Data == "a" && !isExternalHref(getAttr(c, "href")):
+				for gc := c.FirstChild; gc != nil; {
+					following := gc.NextSibling
+					c.RemoveChild(gc)
+					n.InsertBefore(gc, c)
+					gc = following
+				}
+				n.RemoveChild(c)
+			}
+		}
+		c = next
+	}
+}
+
+func isExternalHref(href string) bool {
+	u, err := url.Parse(strings.TrimSpace(href))
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https" || u.Scheme == "mailto")
+}
+
+// xmlToHTML converts a parsed XHTML element into an html.Node tree.
+func xmlToHTML(n *xmlNode) *html.Node {
+	if n == nil {
+		return nil
+	}
+	if n.name == "" {
+		return htmlText(n.text)
+	}
+	name := strings.ToLower(n.name)
+	el := newElement(name, atom.Lookup([]byte(name)))
+	keys := make([]string, 0, len(n.attrs))
+	for key := range n.attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		el.Attr = append(el.Attr, html.Attribute{Key: strings.ToLower(key), Val: n.attrs[key]})
+	}
+	for _, c := range n.children {
+		el.AppendChild(xmlToHTML(c))
+	}
+	return el
+}
@@ -0,0 +1,337 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// ContentBlock is one structural element of extracted content, for callers that
+// want the structure directly rather than re-parsing Markdown.
+type ContentBlock struct {
+	Type     string     `json:"type"` // heading, paragraph, list, code, table, image or quote
+	Path     string     `json:"path"` // CSS-style path to the element in the original page
+	Level    int        `json:"level,omitempty"`
+	Text     string     `json:"text,omitempty"`
+	Ordered  bool       `json:"ordered,omitempty"`
+	Items    []string   `json:"items,omitempty"`
+	Language string     `json:"language,omitempty"`
+	Rows     [][]string `json:"rows,omitempty"`
+	URL      string     `json:"url,omitempty"`
+	Alt      string     `json:"alt,omitempty"`
+}
+
+// Tags kept by HTML(), with the attributes each may keep. Anything else is unwrapped.
+var allowedHTML = map[string][]string{
+	"p": nil, "h1": nil, "h2": nil, "h3": nil, "h4": nil, "h5": nil, "h6": nil,
+	"ul": nil, "ol": {"start"}, "li": nil, "dl": nil, "dt": nil, "dd": nil,
+	"a": {"href", "title"}, "img": {"src", "alt", "title", "width", "height"},
+	"pre": nil, "code": {"class"}, "blockquote": {"cite"}, "q": nil, "cite": nil,
+	"em": nil, "i": nil, "strong": nil, "b": nil, "u": nil, "s": nil, "del": nil, "ins": nil,
+	"sub": nil, "sup": nil, "mark": nil, "small": nil, "abbr": {"title"}, "time": {"datetime"},
+	"kbd": nil, "samp": nil, "var": nil, "br": nil, "hr": nil,
+	"table": nil, "caption": nil, "thead": nil, "tbody": nil, "tfoot": nil, "tr": nil,
+	"th": {"colspan", "rowspan", "scope"}, "td": {"colspan", "rowspan"},
+	"figure": nil, "figcaption": nil,
+}
+
+// Tags dropped together with their content
+var droppedHTML = map[string]bool{
+	"script": true, "style": true, "template": true, "iframe": true, "object": true,
+	"embed": true, "form": true, "input": true, "button": true, "select": true,
+	"textarea": true, "svg": true, "math": true, "noscript": true,
+}
+
+// Text renders the content as plain text with paragraph breaks.
+func (e *Extraction) Text() string {
+	return cleanMarkdown(nodeToText(e.Node))
+}
+
+// HTML renders the content as sanitized, minimal HTML: a fixed set of structural
+// tags, no scripts, styles or event handlers, and absolute links.
+func (e *Extraction) HTML() string {
+	var base *url.URL
+	if e.PageURL != "" {
+		base, _ = url.Parse(e.PageURL)
+	}
+
+	root := newElement("div", 0)
+	sanitizeChildren(e.Node, root, base)
+
+	var buf bytes.Buffer
+	for c := root.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode && strings.TrimSpace(c.Data) == "" {
+			continue
+		}
+		if err := html.Render(&buf, c); err != nil {
+			break
+		}
+		buf.WriteString("\n")
+	}
+	return strings.TrimSpace(buf.String())
+}
+
+func sanitizeChildren(src, dst *html.Node, base *url.URL) {
+	for c := src.FirstChild; c != nil; c = c.NextSibling {
+		switch c.Type {
+		case html.TextNode:
+			dst.AppendChild(&html.Node{Type: html.TextNode, Data: c.Data})
+			continue
+		case html.ElementNode:
+		default:
+			continue
+		}
+
+		if droppedHTML[c.Data] {
+			continue
+		}
+		allowed, ok := allowedHTML[c.Data]
+		if !ok {
+			sanitizeChildren(c, dst, base)
+			continue
+		}
+
+		el := newElement(c.Data, c.DataAtom)
+		for _, key := range allowed {
+			val := getAttr(c, key)
+			if val == "" {
+				continue
+			}
+			switch key {
+			case "href", "src":
+				val = safeURL(val, base)
+				if val == "" {
+					continue
+				}
+			case "class":
+				// Only the language hint on code survives
+				m := reCodeLanguage.FindStringSubmatch(val)
+				if m == nil {
+					continue
+				}
+				val = "language-" + m[1]
+			}
+			el.Attr = append(el.Attr, html.Attribute{Key: key, Val: val})
+		}
+		if c.Data == "img" && getAttr(el, "src") == "" {
+			continue
+		}
+
+		dst.AppendChild(el)
+		sanitizeChildren(c, el, base)
+	}
+}
+
+// safeURL resolves href against base and drops anything that isn't http(s) or mailto.
+func safeURL(href string, base *url.URL) string {
+	u, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return ""
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "mailto":
+		return u.String()
+	case "":
+		if base == nil {
+			return u.String()
+		}
+	}
+	return ""
+}
+
+// Blocks returns the content as a flat list of headings, paragraphs, lists, code,
+// tables, images and quotes, in document order.
+func (e *Extraction) Blocks() []ContentBlock {
+	b := &blockCollector{extraction: e, text: newMarkdownRenderer("", true)}
+	if e.PageURL != "" {
+		b.base, _ = url.Parse(e.PageURL)
+	}
+	b.children(e.Node)
+	return b.blocks
+}
+
+type blockCollector struct {
+	extraction *Extraction
+	text       *markdownRenderer
+	base       *url.URL
+	blocks     []ContentBlock
+}
+
+// children walks n's children, turning runs of inline content into paragraphs.
+func (b *blockCollector) children(n *html.Node) {
+	var inline []*html.Node
+	flush := func() {
+		var sb strings.Builder
+		for _, c := range inline {
+			sb.WriteString(b.text.inline(c))
+		}
+		b.paragraph(n, sb.String())
+		for _, c := range inline {
+			b.images(c)
+		}
+		inline = inline[:0]
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && blockElems[c.Data] {
+			flush()
+			b.block(c)
+			continue
+		}
+		inline = append(inline, c)
+	}
+	flush()
+}
+
+func (b *blockCollector) block(n *html.Node) {
+	path := b.extraction.Path(n)
+
+	switch n.Data {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		if text := collapse(b.text.inlineChildren(n)); text != "" {
+			b.blocks = append(b.blocks, ContentBlock{Type: "heading", Path: path, Level: int(n.Data[1] - '0'), Text: text})
+		}
+	case "p", "dt", "dd", "summary", "figcaption", "address":
+		b.paragraph(n, b.text.inlineChildren(n))
+		b.images(n)
+	case "ul", "ol":
+		block := ContentBlock{Type: "list", Path: path, Ordered: n.Data == "ol"}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && c.Data == "li" {
+				block.Items = append(block.Items, collapse(nodeToText(c)))
+			}
+		}
+		if len(block.Items) > 0 {
+			b.blocks = append(b.blocks, block)
+		}
+	case "pre":
+		block := ContentBlock{Type: "code", Path: path, Text: strings.Trim(rawText(n), "\n")}
+		for _, el := range append([]*html.Node{n}, findAll(n, "code")...) {
+			if m := reCodeLanguage.FindStringSubmatch(getAttr(el, "class")); m != nil {
+				block.Language = m[1]
+				break
+			}
+		}
+		b.blocks = append(b.blocks, block)
+	case "table":
+		if !isDataTable(n) {
+			for _, cell := range findAll(n, "td", "th") {
+				b.children(cell)
+			}
+			return
+		}
+		block := ContentBlock{Type: "table", Path: path}
+		for _, tr := range tableRows(n) {
+			var row []string
+			for c := tr.FirstChild; c != nil; c = c.NextSibling {
+				if c.Type == html.ElementNode && (c.Data == "td" || c.Data == "th") {
+					row = append(row, collapse(b.text.inlineChildren(c)))
+				}
+			}
+			if len(row) > 0 {
+				block.Rows = append(block.Rows, row)
+			}
+		}
+		if captions := findAll(n, "caption"); len(captions) > 0 {
+			block.Text = collapse(b.text.inlineChildren(captions[0]))
+		}
+		if len(block.Rows) > 0 {
+			b.blocks = append(b.blocks, block)
+		}
+	case "blockquote":
+		if text := strings.TrimSpace(nodeToText(n)); text != "" {
+			b.blocks = append(b.blocks, ContentBlock{Type: "quote", Path: path, Text: text})
+		}
+	case "hr":
+	default:
+		b.children(n)
+	}
+}
+
+func (b *blockCollector) paragraph(n *html.Node, inline string) {
+	if text := b.text.paragraph(inline); text != "" {
+		b.blocks = append(b.blocks, ContentBlock{Type: "paragraph", Path: b.extraction.Path(n), Text: text})
+	}
+}
+
+// images emits an image block for every <img> at or under n.
+func (b *blockCollector) images(n *html.Node) {
+	imgs := findAll(n, "img")
+	if isTag(n, "img") {
+		imgs = []*html.Node{n}
+	}
+	for _, img := range imgs {
+		src := getAttr(img, "src")
+		if src == "" {
+			src = getAttr(img, "data-src")
+		}
+		if src = safeURL(src, b.base); src == "" {
+			continue
+		}
+		b.blocks = append(b.blocks, ContentBlock{
+			Type: "image",
+			Path: b.extraction.Path(img),
+			URL:  src,
+			Alt:  collapse(getAttr(img, "alt")),
+		})
+	}
+}
+
+// Path returns a CSS-style path to n's original element in the source page. Nodes
+// created during extraction are described relative to their nearest original ancestor.
+func (e *Extraction) Path(n *html.Node) string {
+	var created []string
+	for ; n != nil; n = n.Parent {
+		if orig, ok := e.origins[n]; ok {
+			return strings.Join(append([]string{domPath(orig)}, created...), " > ")
+		}
+		if n.Type == html.ElementNode {
+			created = append([]string{n.Data}, created...)
+		}
+	}
+	return strings.Join(created, " > ")
+}
+
+// domPath builds a selector-like path from the root (or the nearest id) down to n.
+func domPath(n *html.Node) string {
+	var segments []string
+	for ; n != nil && n.Type == html.ElementNode; n = n.Parent {
+		if id := getAttr(n, "id"); id != "" && !strings.ContainsAny(id, " >") {
+			segments = append(segments, n.Data+"#"+id)
+			break
+		}
+
+		segment := n.Data
+		if n.Parent != nil {
+			index, total := 0, 0
+			for s := n.Parent.FirstChild; s != nil; s = s.NextSibling {
+				if s.Type == html.ElementNode && s.Data == n.Data {
+					total++
+					if s == n {
+						index = total
+					}
+				}
+			}
+			if total > 1 {
+				segment += fmt.Sprintf(":nth-of-type(%d)", index)
+			}
+		}
+		segments = append(segments, segment)
+	}
+
+	for i, j := 0, len(segments)-1; i < j; i, j = i+1, j-1 {
+		segments[i], segments[j] = segments[j], segments[i]
+	}
+	return strings.Join(segments, " > ")
+}
+
+// collapse joins the words of s with single spaces.
+func collapse(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FrontMatter describes where scraped content came from, so saved output stands on its own.
+type FrontMatter struct {
+	Title       string `json:"title,omitempty"`
+	URL         string `json:"url"` // Canonical URL when the page declares one
+	SiteName    string `json:"site_name,omitempty"`
+	Author      string `json:"author,omitempty"`
+	Published   string `json:"published,omitempty"`
+	Language    string `json:"language,omitempty"`
+	FetchedAt   string `json:"fetched_at"`   // RFC 3339
+	ContentHash string `json:"content_hash"` // "sha256:" and the hex digest of the content
+}
+
+// ContentHash returns the "sha256:<hex>" digest of content.
+func ContentHash(content string) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(content)))
+}
+
+// YAML renders f as a front matter block between "---" lines, leaving out empty fields.
+// Values are double-quoted, so titles with colons or leading dashes stay strings.
+func (f FrontMatter) YAML() string {
+	var b strings.Builder
+	b.WriteString("---\n")
+	for _, field := range [][2]string{
+		{"title", f.Title},
+		{"url", f.URL},
+		{"site_name", f.SiteName},
+		{"author", f.Author},
+		{"published", f.Published},
+		{"language", f.Language},
+		{"fetched_at", f.FetchedAt},
+		{"content_hash", f.ContentHash},
+	} {
+		if field[1] != "" {
+			// Go's quoted strings use only escapes YAML double-quoted scalars also have
+			b.WriteString(field[0] + ": " + strconv.Quote(field[1]) + "\n")
+		}
+	}
+	b.WriteString("---\n")
+	return b.String()
+}
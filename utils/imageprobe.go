@@ -0,0 +1,296 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// imageProbeBytes is how much of the image we request. Enough for the headers of
+// every format we understand, and usually enough to spot a second GIF frame.
+const imageProbeBytes = 64 * 1024
+
+// ImageProbe describes an image as reported by its own header bytes.
+type ImageProbe struct {
+	URL      string `json:"url"`
+	MimeType string `json:"mime_type"`
+	Width    int    `json:"width,omitempty"`
+	Height   int    `json:"height,omitempty"`
+	Bytes    int64  `json:"bytes,omitempty"` // Total size, 0 if the server didn't say
+	Animated bool   `json:"animated"`
+}
+
+// ProbeImage fetches the first bytes of an image with a ranged GET and decodes its
+// real format, dimensions and animation flag. Results are cached in Redis.
+func ProbeImage(ctx context.Context, imageURL string) (*ImageProbe, error) {
+	if cached, err := getImageProbeCache(ctx, imageURL); err == nil {
+		return cached, nil
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	req, err := http.NewRequestWithContext(ctx, "GET", imageURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", imageProbeBytes-1))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch image: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("image returned status: %d", resp.StatusCode)
+	}
+
+	// Servers that ignore Range send the whole file, so cap what we read either way
+	head, err := io.ReadAll(io.LimitReader(resp.Body, imageProbeBytes))
+	if err != nil && len(head) == 0 {
+		return nil, fmt.Errorf("failed to read image: %w", err)
+	}
+
+	probe := sniffImage(head)
+	if probe == nil {
+		return nil, fmt.Errorf("unrecognised image format (server said %q)", resp.Header.Get("Content-Type"))
+	}
+	probe.URL = imageURL
+	probe.Bytes = imageSize(resp)
+
+	_ = setImageProbeCache(ctx, imageURL, probe)
+	return probe, nil
+}
+
+// imageSize reads the full object size from Content-Range, or Content-Length for a 200.
+func imageSize(resp *http.Response) int64 {
+	if cr := resp.Header.Get("Content-Range"); cr != "" {
+		// bytes 0-65535/123456
+		if idx := strings.LastIndex(cr, "/"); idx != -1 {
+			if n, err := strconv.ParseInt(cr[idx+1:], 10, 64); err == nil {
+				return n
+			}
+		}
+		return 0
+	}
+	if resp.StatusCode == http.StatusOK && resp.ContentLength > 0 {
+		return resp.ContentLength
+	}
+	return 0
+}
+
+// sniffImage identifies the format from magic bytes and extracts what it can.
+// Returns nil if the bytes aren't an image we recognise.
+func sniffImage(head []byte) *ImageProbe {
+	switch {
+	case bytes.HasPrefix(head, []byte("GIF87a")), bytes.HasPrefix(head, []byte("GIF89a")):
+		probe := decodeImageConfig(head, "image/gif")
+		probe.Animated = gifIsAnimated(head)
+		return probe
+	case bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")):
+		probe := decodeImageConfig(head, "image/png")
+		probe.Animated = pngIsAnimated(head)
+		if probe.Animated {
+			probe.MimeType = "image/apng"
+		}
+		return probe
+	case bytes.HasPrefix(head, []byte("\xff\xd8\xff")):
+		return decodeImageConfig(head, "image/jpeg")
+	case len(head) >= 12 && string(head[0:4]) == "RIFF" && string(head[8:12]) == "WEBP":
+		return sniffWebP(head)
+	case len(head) >= 12 && string(head[4:8]) == "ftyp":
+		return sniffAVIF(head)
+	}
+
+	// Formats we can only name, not measure
+	switch mime := http.DetectContentType(head); {
+	case strings.HasPrefix(mime, "image/"):
+		return &ImageProbe{MimeType: mime}
+	case bytes.Contains(head[:min(len(head), 512)], []byte("<svg")):
+		return &ImageProbe{MimeType: "image/svg+xml"}
+	}
+	return nil
+}
+
+// decodeImageConfig runs the stdlib decoder over the header bytes for dimensions.
+func decodeImageConfig(head []byte, mime string) *ImageProbe {
+	probe := &ImageProbe{MimeType: mime}
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(head)); err == nil {
+		probe.Width = cfg.Width
+		probe.Height = cfg.Height
+	}
+	return probe
+}
+
+// gifIsAnimated walks the GIF block structure and reports whether more than one
+// image descriptor appears within the bytes we have.
+func gifIsAnimated(head []byte) bool {
+	if len(head) < 13 {
+		return false
+	}
+	pos := 13
+	// Global colour table
+	if head[10]&0x80 != 0 {
+		pos += 3 * (1 << (int(head[10]&0x07) + 1))
+	}
+
+	frames := 0
+	for pos < len(head) {
+		switch head[pos] {
+		case 0x21: // Extension: label, then sub-blocks
+			pos += 2
+			pos = skipGIFSubBlocks(head, pos)
+		case 0x2C: // Image descriptor
+			frames++
+			if frames > 1 {
+				return true
+			}
+			if pos+10 > len(head) {
+				return false
+			}
+			flags := head[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 * (1 << (int(flags&0x07) + 1))
+			}
+			pos++ // LZW minimum code size
+			pos = skipGIFSubBlocks(head, pos)
+		default: // Trailer or garbage
+			return false
+		}
+	}
+	return false
+}
+
+func skipGIFSubBlocks(head []byte, pos int) int {
+	for pos < len(head) {
+		size := int(head[pos])
+		pos++
+		if size == 0 {
+			break
+		}
+		pos += size
+	}
+	return pos
+}
+
+// pngIsAnimated looks for an APNG animation control chunk before the image data.
+func pngIsAnimated(head []byte) bool {
+	pos := 8
+	for pos+8 <= len(head) {
+		length := int(binary.BigEndian.Uint32(head[pos : pos+4]))
+		chunk := string(head[pos+4 : pos+8])
+		switch chunk {
+		case "acTL":
+			return true
+		case "IDAT":
+			return false
+		}
+		pos += 12 + length
+	}
+	return false
+}
+
+// sniffWebP reads dimensions from the lossy, lossless or extended WebP headers.
+func sniffWebP(head []byte) *ImageProbe {
+	probe := &ImageProbe{MimeType: "image/webp"}
+	if len(head) < 30 {
+		return probe
+	}
+
+	switch string(head[12:16]) {
+	case "VP8 ":
+		// Frame tag (3) + start code (3), then 14-bit width and height
+		probe.Width = int(binary.LittleEndian.Uint16(head[26:28]) & 0x3fff)
+		probe.Height = int(binary.LittleEndian.Uint16(head[28:30]) & 0x3fff)
+	case "VP8L":
+		// Signature byte, then 14-bit width-1 and height-1 packed into 28 bits
+		bits := binary.LittleEndian.Uint32(head[21:25])
+		probe.Width = int(bits&0x3fff) + 1
+		probe.Height = int((bits>>14)&0x3fff) + 1
+	case "VP8X":
+		flags := head[20]
+		probe.Animated = flags&0x02 != 0
+		probe.Width = int(uint32(head[24])|uint32(head[25])<<8|uint32(head[26])<<16) + 1
+		probe.Height = int(uint32(head[27])|uint32(head[28])<<8|uint32(head[29])<<16) + 1
+	}
+	return probe
+}
+
+// sniffAVIF checks the ftyp brands and reads dimensions from the first ispe property.
+func sniffAVIF(head []byte) *ImageProbe {
+	size := int(binary.BigEndian.Uint32(head[0:4]))
+	if size < 16 || size > len(head) {
+		size = min(len(head), 64)
+	}
+	brands := string(head[8:size])
+
+	var probe *ImageProbe
+	switch {
+	case strings.Contains(brands, "avis"):
+		probe = &ImageProbe{MimeType: "image/avif", Animated: true}
+	case strings.Contains(brands, "avif"):
+		probe = &ImageProbe{MimeType: "image/avif"}
+	case strings.Contains(brands, "heic"), strings.Contains(brands, "heix"), strings.Contains(brands, "mif1"):
+		probe = &ImageProbe{MimeType: "image/heic"}
+	default:
+		return nil
+	}
+
+	// ispe: full box header (4) then 32-bit width and height
+	if idx := bytes.Index(head, []byte("ispe")); idx != -1 && idx+16 <= len(head) {
+		probe.Width = int(binary.BigEndian.Uint32(head[idx+8 : idx+12]))
+		probe.Height = int(binary.BigEndian.Uint32(head[idx+12 : idx+16]))
+	}
+	return probe
+}
+
+func imageProbeCacheKey(imageURL string) string {
+	return fmt.Sprintf("web:image:%x", sha256.Sum256([]byte(imageURL)))
+}
+
+func getImageProbeCache(ctx context.Context, imageURL string) (*ImageProbe, error) {
+	if RDB == nil {
+		return nil, fmt.Errorf("redis not initialized")
+	}
+	if cacheBypassed(ctx) {
+		return nil, redis.Nil
+	}
+
+	val, err := RDB.Get(ctx, imageProbeCacheKey(imageURL)).Result()
+	if err != nil {
+		return nil, err
+	}
+	var probe ImageProbe
+	if err := json.Unmarshal([]byte(val), &probe); err != nil {
+		return nil, err
+	}
+	return &probe, nil
+}
+
+func setImageProbeCache(ctx context.Context, imageURL string, probe *ImageProbe) error {
+	if RDB == nil {
+		return fmt.Errorf("redis not initialized")
+	}
+
+	data, err := json.Marshal(probe)
+	if err != nil {
+		return err
+	}
+	// Images behind a URL rarely change, so keep these much longer than page HTML
+	return RDB.Set(ctx, imageProbeCacheKey(imageURL), data, 24*time.Hour).Err()
+}
@@ -0,0 +1,352 @@
+package utils
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+// LanguageResult is the outcome of DetectLanguage.
+type LanguageResult struct {
+	Language   string  `json:"language"`   // ISO 639-1 code, e.g. "en"
+	Confidence float64 `json:"confidence"` // 0..1
+	Source     string  `json:"source"`     // "text", "declared" or "text+declared"
+}
+
+// minLanguageWords is the least amount of text we trust a word-profile guess on.
+const minLanguageWords = 20
+
+// languageProfiles holds the most frequent short words of each Latin-script language.
+// Function words are the strongest cheap signal for telling these apart.
+var languageProfiles = map[string][]string{
+	"en": {"the", "and", "of", "to", "in", "is", "that", "for", "it", "with", "as", "was", "on", "are", "be", "this", "by", "have", "from", "or", "not", "but", "what", "which", "you", "they", "we", "has", "were", "their", "an", "at", "will", "would", "there", "can", "been", "more", "when", "who"},
+	"de": {"der", "die", "und", "in", "den", "von", "zu", "das", "mit", "sich", "des", "auf", "für", "ist", "im", "dem", "nicht", "ein", "eine", "als", "auch", "es", "an", "werden", "aus", "er", "hat", "dass", "sie", "nach", "wird", "bei", "einer", "um", "am", "sind", "noch", "wie", "einem", "über"},
+	"fr": {"de", "la", "le", "et", "les", "des", "en", "un", "du", "une", "que", "est", "pour", "qui", "dans", "par", "plus", "pas", "au", "sur", "ne", "se", "ce", "il", "sont", "aux", "avec", "son", "ont", "mais", "nous", "vous", "leur", "été", "comme", "cette", "elle", "ou", "sa", "ses"},
+	"es": {"de", "la", "que", "el", "en", "y", "los", "del", "se", "las", "por", "un", "para", "con", "no", "una", "su", "al", "es", "lo", "como", "más", "pero", "sus", "le", "ya", "fue", "este", "ha", "sí", "porque", "esta", "son", "entre", "cuando", "muy", "sin", "sobre", "también", "hasta"},
+	"it": {"di", "e", "il", "la", "che", "in", "a", "per", "un", "è", "del", "non", "una", "della", "le", "i", "si", "con", "da", "sono", "al", "come", "anche", "più", "nel", "dei", "gli", "alla", "ma", "questo", "lo", "ha", "delle", "nella", "essere", "o", "suo", "loro", "stato", "tra"},
+	"pt": {"de", "a", "o", "que", "e", "do", "da", "em", "um", "para", "é", "com", "não", "uma", "os", "no", "se", "na", "por", "mais", "as", "dos", "como", "mas", "foi", "ao", "ele", "das", "tem", "à", "seu", "sua", "ou", "ser", "quando", "muito", "há", "nos", "já", "também"},
+	"nl": {"de", "en", "van", "het", "een", "in", "is", "dat", "op", "te", "zijn", "voor", "met", "die", "niet", "aan", "er", "om", "ook", "als", "dan", "maar", "bij", "of", "uit", "nog", "wordt", "worden", "door", "naar", "heeft", "hij", "ze", "wat", "kan", "tot", "over", "meer", "geen", "werd"},
+	"sv": {"och", "i", "att", "det", "som", "en", "på", "är", "av", "för", "med", "till", "den", "har", "de", "inte", "om", "ett", "han", "men", "var", "jag", "sig", "från", "vi", "så", "kan", "man", "när", "år", "hade", "skulle", "eller", "nu", "efter", "vid", "också", "under", "sin", "mot"},
+	"da": {"og", "i", "at", "det", "en", "til", "er", "som", "på", "de", "med", "for", "af", "den", "ikke", "der", "var", "et", "han", "har", "jeg", "om", "vi", "men", "fra", "sig", "kan", "så", "efter", "blev", "også", "ved", "eller", "når", "skal", "være", "have", "hvor", "over", "mod"},
+	"no": {"og", "i", "det", "som", "en", "på", "er", "til", "å", "av", "for", "med", "at", "den", "har", "ikke", "de", "et", "om", "han", "var", "jeg", "men", "fra", "vi", "kan", "seg", "så", "etter", "også", "ble", "eller", "skal", "hadde", "være", "når", "mot", "dette", "over", "sin"},
+	"fi": {"ja", "on", "ei", "että", "se", "oli", "hän", "mutta", "kun", "ovat", "myös", "tai", "sen", "ole", "niin", "jo", "kuin", "voi", "nyt", "sitä", "mitä", "vain", "joka", "ne", "tämä", "jos", "olla", "hänen", "sekä", "kanssa", "mukaan", "vuoden", "kaikki", "siitä", "jälkeen", "vielä", "sitten", "koska", "jotka", "jotta"},
+	"pl": {"i", "w", "się", "nie", "na", "z", "do", "to", "że", "jest", "o", "jak", "ale", "po", "co", "tak", "za", "od", "jego", "przez", "dla", "tym", "czy", "już", "był", "ich", "są", "może", "jej", "tylko", "przy", "było", "jako", "ten", "także", "oraz", "który", "która", "które", "bardzo"},
+	"cs": {"a", "v", "se", "na", "je", "že", "to", "s", "z", "do", "o", "i", "k", "jsem", "ve", "pro", "by", "ale", "jako", "tak", "po", "jsou", "jeho", "od", "za", "už", "jak", "který", "která", "které", "bylo", "byl", "jen", "také", "podle", "při", "nebo", "není", "mezi", "když"},
+	"tr": {"ve", "bir", "bu", "da", "de", "için", "ile", "çok", "olarak", "daha", "gibi", "en", "ne", "o", "var", "olan", "ama", "sonra", "kadar", "her", "ki", "mi", "değil", "onun", "ya", "göre", "ancak", "yok", "şey", "olduğu", "tarafından", "böyle", "ise", "diye", "bile", "şu", "hem", "yeni", "arasında", "ilk"},
+	"hu": {"a", "az", "és", "hogy", "nem", "is", "egy", "meg", "de", "van", "ez", "csak", "még", "már", "mint", "el", "ki", "volt", "azt", "kell", "vagy", "ha", "fel", "sem", "lesz", "pedig", "majd", "után", "amely", "nagyon", "mert", "között", "őket", "itt", "ezt", "minden", "olyan", "vannak", "szerint", "lehet"},
+	"ro": {"de", "și", "în", "la", "a", "cu", "pe", "nu", "o", "că", "din", "se", "este", "un", "care", "pentru", "mai", "sunt", "fost", "ca", "sau", "dar", "lui", "au", "cel", "acest", "după", "această", "într", "prin", "fi", "foarte", "ei", "avea", "dintre", "când", "numai", "despre", "doar", "cum"},
+	"id": {"yang", "dan", "di", "ini", "itu", "dengan", "untuk", "tidak", "dari", "dalam", "akan", "pada", "juga", "saya", "ke", "karena", "tersebut", "bisa", "ada", "mereka", "lebih", "kami", "oleh", "sudah", "atau", "saat", "telah", "hanya", "kita", "seperti", "namun", "harus", "bagi", "dapat", "masih", "setelah", "tahun", "sangat", "baru", "menjadi"},
+}
+
+// languageLetters are characters that are close to unique to one language and
+// tip the balance between closely related profiles.
+var languageLetters = map[rune]string{
+	'ß': "de", 'ñ': "es", 'ã': "pt", 'õ': "pt",
+	'ø': "no", 'æ': "da", 'ğ': "tr", 'ş': "tr", 'ı': "tr",
+	'ł': "pl", 'ś': "pl", 'ż': "pl", 'ź': "pl", 'ą': "pl", 'ę': "pl",
+	'ř': "cs", 'ů': "cs", 'ě': "cs", 'ő': "hu", 'ű': "hu",
+	'ă': "ro", 'ț': "ro", 'ș': "ro",
+}
+
+var languageWordSets = func() map[string]map[string]bool {
+	sets := make(map[string]map[string]bool, len(languageProfiles))
+	for lang, words := range languageProfiles {
+		set := make(map[string]bool, len(words))
+		for _, w := range words {
+			set[w] = true
+		}
+		sets[lang] = set
+	}
+	return sets
+}()
+
+// DetectLanguage identifies the language of text and cross-checks it against the
+// languages the page declares (html lang, meta content-language, og:locale).
+// Declared values may be in any common form ("en", "en-GB", "en_US").
+func DetectLanguage(text string, declared ...string) LanguageResult {
+	detected, confidence, words, byScript := detectTextLanguage(text)
+	declaredLang := mostCommonDeclared(declared)
+
+	switch {
+	case detected == "" && declaredLang == "":
+		return LanguageResult{}
+	case detected == "":
+		return LanguageResult{Language: declaredLang, Confidence: 0.5, Source: "declared"}
+	case declaredLang == "":
+		return LanguageResult{Language: detected, Confidence: confidence, Source: "text"}
+	case detected == declaredLang:
+		// Independent signals agree; close most of the remaining gap
+		return LanguageResult{Language: detected, Confidence: round2(confidence + (1-confidence)*0.6), Source: "text+declared"}
+	case (words < minLanguageWords && !byScript) || confidence < 0.5:
+		// Too little or too ambiguous text to overrule the page's own declaration.
+		// Templates often ship a stale lang attribute, so don't trust it fully either.
+		// A different writing system, though, is decisive at any length.
+		return LanguageResult{Language: declaredLang, Confidence: 0.5, Source: "declared"}
+	default:
+		return LanguageResult{Language: detected, Confidence: round2(confidence * 0.9), Source: "text"}
+	}
+}
+
+// DeclaredLanguages collects the languages a document declares about itself:
+// <html lang>, <meta http-equiv="content-language"> and og:locale.
+func DeclaredLanguages(doc *html.Node) []string {
+	var langs []string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "html":
+				if lang := getAttr(n, "lang"); lang != "" {
+					langs = append(langs, lang)
+				}
+			case "meta":
+				if strings.EqualFold(getAttr(n, "http-equiv"), "content-language") || getAttr(n, "property") == "og:locale" {
+					if content := getAttr(n, "content"); content != "" {
+						langs = append(langs, content)
+					}
+				}
+			case "body":
+				return // Declarations live in <head>
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return langs
+}
+
+// PageText returns the visible text of doc's body without scripts, navigation,
+// headers, footers or asides: enough to detect a language from, without the cost
+// of extracting the main content.
+func PageText(doc *html.Node) string {
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			sb.WriteString(n.Data)
+			sb.WriteByte(' ')
+			return
+		case html.ElementNode:
+			switch n.Data {
+			case "head", "nav", "header", "footer", "aside":
+				return
+			}
+			if nonContentTags[n.Data] || isHiddenElement(n) {
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return collapse(sb.String())
+}
+
+// detectTextLanguage guesses the language of text by script first and then, for
+// Latin text, by function-word frequency. Returns the code, a confidence, the word
+// count and whether the writing system alone decided it.
+func detectTextLanguage(text string) (string, float64, int, bool) {
+	scripts := make(map[string]int)
+	letters := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		scripts[scriptOf(r)]++
+	}
+	if letters == 0 {
+		return "", 0, 0, false
+	}
+
+	// Dominant non-Latin scripts mostly identify the language on their own
+	var topScript string
+	for script, count := range scripts {
+		// Ties go to the first script by name, so the same text always gets the same answer
+		if topScript == "" || count > scripts[topScript] || (count == scripts[topScript] && script < topScript) {
+			topScript = script
+		}
+	}
+	scriptShare := float64(scripts[topScript]) / float64(letters)
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+
+	// Japanese mixes kanji with kana, so treat the two as one script
+	cjkShare := float64(scripts["han"]+scripts["kana"]) / float64(letters)
+
+	switch topScript {
+	case "han":
+		// Any kana at all means Japanese; Chinese text has none
+		if scripts["kana"] > 0 {
+			return "ja", round2(cjkShare), len(words), true
+		}
+		return "zh", round2(scriptShare), len(words), true
+	case "kana":
+		return "ja", round2(cjkShare), len(words), true
+	case "hangul":
+		return "ko", round2(scriptShare), len(words), true
+	case "cyrillic":
+		return cyrillicLanguage(text), round2(scriptShare * 0.9), len(words), true
+	case "arabic":
+		if strings.ContainsAny(text, "پچژگ") {
+			return "fa", round2(scriptShare * 0.9), len(words), true
+		}
+		return "ar", round2(scriptShare * 0.9), len(words), true
+	case "hebrew", "greek", "devanagari", "thai":
+		return map[string]string{"hebrew": "he", "greek": "el", "devanagari": "hi", "thai": "th"}[topScript], round2(scriptShare), len(words), true
+	case "latin":
+		lang, confidence := latinLanguage(words, text)
+		return lang, round2(confidence * scriptShare), len(words), false
+	}
+	return "", 0, len(words), false
+}
+
+// latinLanguage scores each profile by how many of the text's words it contains.
+func latinLanguage(words []string, text string) (string, float64) {
+	scores := make(map[string]float64)
+	for _, w := range words {
+		for lang, set := range languageWordSets {
+			if set[w] {
+				scores[lang]++
+			}
+		}
+	}
+	for _, r := range strings.ToLower(text) {
+		if lang, ok := languageLetters[r]; ok {
+			scores[lang] += 0.5
+		}
+	}
+	if strings.Contains(strings.ToLower(text), "ij") {
+		scores["nl"] += float64(strings.Count(strings.ToLower(text), "ij")) * 0.2
+	}
+
+	type scored struct {
+		lang  string
+		score float64
+	}
+	var ranked []scored
+	var total float64
+	for lang, score := range scores {
+		ranked = append(ranked, scored{lang, score})
+		total += score
+	}
+	if len(ranked) == 0 || total == 0 {
+		return "", 0
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].score == ranked[j].score {
+			return ranked[i].lang < ranked[j].lang
+		}
+		return ranked[i].score > ranked[j].score
+	})
+
+	best := ranked[0]
+	// Confidence from the margin over the runner-up, scaled down for short texts
+	margin := best.score
+	if len(ranked) > 1 {
+		margin = best.score - ranked[1].score
+	}
+	confidence := margin / best.score
+	hitRate := best.score / float64(max(len(words), 1))
+	if hitRate < 0.15 {
+		confidence *= hitRate / 0.15
+	}
+	if len(words) < minLanguageWords {
+		confidence *= float64(len(words)) / minLanguageWords
+	}
+	// Related languages share most function words; a clear margin is already strong evidence
+	return best.lang, min(0.5+confidence/2, 0.99)
+}
+
+// cyrillicLanguage separates the common Cyrillic-script languages by their distinctive letters.
+func cyrillicLanguage(text string) string {
+	lower := strings.ToLower(text)
+	switch {
+	case strings.ContainsAny(lower, "ў"):
+		return "be"
+	case strings.ContainsAny(lower, "іїєґ"):
+		return "uk"
+	case strings.ContainsAny(lower, "ђћџљњј"):
+		return "sr"
+	case strings.Count(lower, "ъ") > strings.Count(lower, "ы")*2 && !strings.ContainsAny(lower, "ё"):
+		return "bg"
+	}
+	return "ru"
+}
+
+// scriptOf buckets a letter into the writing system we care about.
+func scriptOf(r rune) string {
+	switch {
+	case unicode.In(r, unicode.Latin):
+		return "latin"
+	case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+		return "kana"
+	case unicode.In(r, unicode.Han):
+		return "han"
+	case unicode.In(r, unicode.Hangul):
+		return "hangul"
+	case unicode.In(r, unicode.Cyrillic):
+		return "cyrillic"
+	case unicode.In(r, unicode.Arabic):
+		return "arabic"
+	case unicode.In(r, unicode.Hebrew):
+		return "hebrew"
+	case unicode.In(r, unicode.Greek):
+		return "greek"
+	case unicode.In(r, unicode.Devanagari):
+		return "devanagari"
+	case unicode.In(r, unicode.Thai):
+		return "thai"
+	}
+	return "other"
+}
+
+// mostCommonDeclared normalises declared tags to their primary subtag and returns the most frequent.
+func mostCommonDeclared(declared []string) string {
+	counts := make(map[string]int)
+	var order []string
+	for _, d := range declared {
+		// Content-Language may list several; the first is the primary
+		d = strings.TrimSpace(strings.Split(d, ",")[0])
+		if idx := strings.IndexAny(d, "-_"); idx != -1 {
+			d = d[:idx]
+		}
+		d = strings.ToLower(d)
+		if len(d) < 2 || len(d) > 3 || d == "und" {
+			continue
+		}
+		// Legacy and macro-language codes we see in the wild
+		switch d {
+		case "nb", "nn":
+			d = "no"
+		case "iw":
+			d = "he"
+		case "in":
+			d = "id"
+		}
+		if counts[d] == 0 {
+			order = append(order, d)
+		}
+		counts[d]++
+	}
+
+	best := ""
+	for _, d := range order {
+		if best == "" || counts[d] > counts[best] {
+			best = d
+		}
+	}
+	return best
+}
+
+func round2(f float64) float64 {
+	return float64(int(f*100+0.5)) / 100
+}
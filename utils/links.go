@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Link is an outgoing link of a page, merged across all its occurrences.
+type Link struct {
+	URL         string   `json:"url"`
+	Text        string   `json:"text,omitempty"` // Anchor text, preferring an occurrence in the content
+	Rel         []string `json:"rel,omitempty"`  // Union of rel values, e.g. nofollow, sponsored
+	Internal    bool     `json:"internal"`       // Same site as the page, subdomains included
+	InContent   bool     `json:"in_content"`     // At least one occurrence is in the extracted content
+	Occurrences int      `json:"occurrences"`    // How many anchors point here; over 1 means duplicates
+}
+
+// Link filters for Links
+const (
+	LinksAll      = "all"
+	LinksContent  = "content"  // Only links inside the extracted content
+	LinksInternal = "internal" // Only links to the same site
+)
+
+// Links lists the http(s) links of the pages e was extracted from, one entry per URL
+// (fragments ignored) in order of first appearance, filtered by filter.
+func (e *Extraction) Links(filter string) []Link {
+	inContent := make(map[*html.Node]bool)
+	for _, a := range findAll(e.Node, "a") {
+		if orig, ok := e.origins[a]; ok {
+			inContent[orig] = true
+		}
+	}
+
+	var links []Link
+	index := make(map[string]int)
+	for _, source := range e.sources {
+		base, err := url.Parse(source.url)
+		if err != nil {
+			continue
+		}
+		for _, a := range findAll(source.doc, "a", "area") {
+			target := linkTarget(base, getAttr(a, "href"))
+			if target == nil {
+				continue
+			}
+			key := target.String()
+			text := innerText(a)
+			if text == "" {
+				text = collapse(getAttr(a, "aria-label") + " " + getAttr(a, "title"))
+			}
+			if text == "" {
+				if img := findAll(a, "img"); len(img) > 0 {
+					text = collapse(getAttr(img[0], "alt"))
+				}
+			}
+
+			i, seen := index[key]
+			if !seen {
+				i = len(links)
+				index[key] = i
+				links = append(links, Link{URL: key, Text: text, Internal: isInternalHost(target.Hostname(), base.Hostname())})
+			}
+			link := &links[i]
+			link.Occurrences++
+			if inContent[a] {
+				if !link.InContent && text != "" {
+					link.Text = text
+				}
+				link.InContent = true
+			}
+			if link.Text == "" {
+				link.Text = text
+			}
+			for _, rel := range strings.Fields(strings.ToLower(getAttr(a, "rel"))) {
+				if !containsString(link.Rel, rel) {
+					link.Rel = append(link.Rel, rel)
+				}
+			}
+		}
+	}
+
+	filtered := links[:0]
+	for _, link := range links {
+		switch {
+		case filter == LinksContent && !link.InContent:
+		case filter == LinksInternal && !link.Internal:
+		default:
+			filtered = append(filtered, link)
+		}
+	}
+	return filtered
+}
+
+// linkTarget resolves href against base, returning nil for non-http(s) links and
+// links back to the same page.
+func linkTarget(base *url.URL, href string) *url.URL {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "#") {
+		return nil
+	}
+	u, err := url.Parse(href)
+	if err != nil {
+		return nil
+	}
+	u = base.ResolveReference(u)
+	u.Fragment = ""
+	u.RawFragment = ""
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil
+	}
+	self := *base
+	self.Fragment, self.RawFragment = "", ""
+	if u.String() == self.String() {
+		return nil
+	}
+	return u
+}
+
+// isInternalHost reports whether host belongs to the same site as pageHost: the same
+// host, ignoring "www.", or a subdomain of it.
+func isInternalHost(host, pageHost string) bool {
+	host = strings.TrimPrefix(strings.ToLower(host), "www.")
+	pageHost = strings.TrimPrefix(strings.ToLower(pageHost), "www.")
+	return host == pageHost || strings.HasSuffix(host, "."+pageHost)
+}
@@ -0,0 +1,718 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Elements rendered as their own Markdown block rather than inline
+var blockElems = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "center": true,
+	"details": true, "dialog": true, "dd": true, "div": true, "dl": true, "dt": true,
+	"fieldset": true, "figcaption": true, "figure": true, "footer": true, "form": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"header": true, "hgroup": true, "hr": true, "li": true, "main": true, "nav": true,
+	"ol": true, "p": true, "pre": true, "section": true, "summary": true, "table": true,
+	"ul": true, "body": true, "html": true,
+}
+
+var (
+	reCodeLanguage  = regexp.MustCompile(`(?:^|\s)(?:language|lang)-([\w+#.-]+)`)
+	reLineBlockMark = regexp.MustCompile(`^(#{1,6}(?:\s|$)|>|[-+*](?:\s|$)|=+\s*$|-+\s*$)`)
+	reLineOrdered   = regexp.MustCompile(`^(\d{1,9})([.)])(\s|$)`)
+	reEntityLike    = regexp.MustCompile(`&([a-zA-Z][a-zA-Z0-9]*|#[0-9]+|#[xX][0-9a-fA-F]+);`)
+	reSpaces        = regexp.MustCompile(`[ \t]+`)
+	reBacktickRun   = regexp.MustCompile("`+")
+	reEmptyHeading  = regexp.MustCompile(`^#+\s*$`)
+)
+
+// markdownRenderer converts a DOM subtree to CommonMark (plus GFM tables and strikethrough),
+// or, in plain mode, to text with the same block layout and no markup.
+type markdownRenderer struct {
+	base  *url.URL
+	plain bool
+
+	links    string         // One of the Link* styles; "" means LinkInline
+	maxLinks int            // Distinct URLs rendered as links before the rest become text; 0 means no limit
+	linkURLs []string       // Distinct link URLs in order of first use
+	linkRefs map[string]int // URL -> 1-based reference number
+}
+
+// Link styles for MarkdownOptions.Links
+const (
+	LinkInline    = "inline"    // [text](url)
+	LinkReference = "reference" // [text][1], with "[1]: url" definitions at the end
+	LinkFootnote  = "footnote"  // text[^1], with "[^1]: url" footnotes at the end
+	LinkStrip     = "strip"     // text only
+)
+
+// MarkdownOptions controls how links are written by Extraction.MarkdownWith.
+type MarkdownOptions struct {
+	Links    string // Link style; "" means LinkInline
+	MaxLinks int    // Distinct URLs kept as links, in page order; later ones become text. 0 means no limit
+}
+
+// nodeToText converts the DOM subtree to plain text with paragraph breaks
+func nodeToText(n *html.Node) string {
+	return newMarkdownRenderer("", true).render(n)
+}
+
+func newMarkdownRenderer(baseURL string, plain bool) *markdownRenderer {
+	r := &markdownRenderer{plain: plain}
+	if baseURL != "" {
+		if base, err := url.Parse(baseURL); err == nil {
+			r.base = base
+		}
+	}
+	return r
+}
+
+func (r *markdownRenderer) render(n *html.Node) string {
+	var blocks []string
+	if n.Type == html.ElementNode && blockElems[n.Data] {
+		blocks = r.block(n)
+	} else {
+		blocks = r.blocks(n)
+	}
+	return strings.Join(blocks, "\n\n")
+}
+
+// blocks renders the children of n as a list of Markdown blocks. Runs of inline
+// content between block children become paragraphs.
+func (r *markdownRenderer) blocks(n *html.Node) []string {
+	var blocks []string
+	var inline strings.Builder
+
+	flush := func() {
+		if p := r.paragraph(inline.String()); p != "" {
+			blocks = append(blocks, p)
+		}
+		inline.Reset()
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && blockElems[c.Data] {
+			flush()
+			blocks = append(blocks, r.block(c)...)
+			continue
+		}
+		inline.WriteString(r.inline(c))
+	}
+	flush()
+	return blocks
+}
+
+// block renders a single block-level element.
+func (r *markdownRenderer) block(n *html.Node) []string {
+	switch n.Data {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		text := strings.Join(strings.Fields(r.inlineChildren(n)), " ")
+		if text == "" {
+			return nil
+		}
+		if r.plain {
+			return []string{text}
+		}
+		level := int(n.Data[1] - '0')
+		return []string{strings.Repeat("#", level) + " " + text}
+	case "p", "dt", "summary":
+		if p := r.paragraph(r.inlineChildren(n)); p != "" {
+			if n.Data == "dt" && !r.plain {
+				p = "**" + p + "**"
+			}
+			return []string{p}
+		}
+		return nil
+	case "hr":
+		if r.plain {
+			return nil
+		}
+		return []string{"---"}
+	case "pre":
+		if r.plain {
+			return []string{strings.Trim(rawText(n), "\n")}
+		}
+		return []string{r.codeBlock(n)}
+	case "ul", "ol":
+		if list := r.list(n); list != "" {
+			return []string{list}
+		}
+		return nil
+	case "blockquote":
+		blocks := r.blocks(n)
+		if len(blocks) == 0 || r.plain {
+			return blocks
+		}
+		return []string{prefixLines(strings.Join(blocks, "\n\n"), "> ", "> ")}
+	case "dd":
+		inner := strings.Join(r.blocks(n), "\n\n")
+		if inner == "" {
+			return nil
+		}
+		if r.plain {
+			return []string{prefixLines(inner, "  ", "  ")}
+		}
+		return []string{inner}
+	case "dl":
+		if !r.plain {
+			if dl := r.definitionList(n); dl != "" {
+				return []string{dl}
+			}
+			return nil
+		}
+		// Terms and their definitions read best kept together
+		if dl := strings.Join(r.blocks(n), "\n"); dl != "" {
+			return []string{dl}
+		}
+		return nil
+	case "figcaption":
+		if p := r.paragraph(r.inlineChildren(n)); p != "" {
+			if r.plain {
+				return []string{p}
+			}
+			return []string{"*" + p + "*"}
+		}
+		return nil
+	case "table":
+		if isDataTable(n) {
+			if table := r.table(n); table != "" {
+				return []string{table}
+			}
+			return nil
+		}
+		// Layout tables: just their content, cell by cell
+		var blocks []string
+		for _, cell := range findAll(n, "td", "th") {
+			blocks = append(blocks, r.blocks(cell)...)
+		}
+		return blocks
+	}
+	return r.blocks(n)
+}
+
+// inline renders a node in inline context.
+func (r *markdownRenderer) inline(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		text := reSpaces.ReplaceAllString(strings.NewReplacer("\n", " ", "\r", " ").Replace(n.Data), " ")
+		if r.plain {
+			return text
+		}
+		return escapeMarkdown(text)
+	case html.ElementNode:
+	default:
+		return ""
+	}
+
+	if r.plain {
+		switch n.Data {
+		case "br":
+			return "\n"
+		case "img", "script", "style", "template":
+			return ""
+		case "code", "kbd", "samp", "tt":
+			return strings.Join(strings.Fields(rawText(n)), " ")
+		}
+		if blockElems[n.Data] {
+			return " " + r.inlineChildren(n) + " "
+		}
+		return r.inlineChildren(n)
+	}
+
+	switch n.Data {
+	case "br":
+		return "\n"
+	case "strong", "b":
+		return wrapInline(r.inlineChildren(n), "**")
+	case "em", "i", "cite", "dfn":
+		return wrapInline(r.inlineChildren(n), "*")
+	case "del", "s", "strike":
+		return wrapInline(r.inlineChildren(n), "~~")
+	case "code", "kbd", "samp", "tt":
+		return inlineCode(rawText(n))
+	case "img":
+		return r.image(n)
+	case "a":
+		return r.link(n)
+	case "script", "style", "template":
+		return ""
+	}
+
+	// Block elements nested in inline context flatten to their text
+	if blockElems[n.Data] {
+		return " " + r.inlineChildren(n) + " "
+	}
+	return r.inlineChildren(n)
+}
+
+func (r *markdownRenderer) inlineChildren(n *html.Node) string {
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(r.inline(c))
+	}
+	return sb.String()
+}
+
+func (r *markdownRenderer) link(n *html.Node) string {
+	href := strings.TrimSpace(getAttr(n, "href"))
+	text := strings.TrimSpace(strings.Join(strings.Fields(r.inlineChildren(n)), " "))
+	if href == "" || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+		return text
+	}
+
+	// RULE: Only format as a Markdown link if the text is short (likely a title or button)
+	// If it's a massive block of text, just output the text to avoid syntactic mess.
+	if len(text) == 0 || len(text) >= 200 {
+		return text + " "
+	}
+	if r.links == LinkStrip {
+		return text
+	}
+
+	target := r.resolve(href)
+	ref, seen := r.linkRefs[target]
+	if !seen {
+		// Repeats of a URL already linked don't count against the budget
+		if r.maxLinks > 0 && len(r.linkURLs) >= r.maxLinks {
+			return text
+		}
+		if r.linkRefs == nil {
+			r.linkRefs = make(map[string]int)
+		}
+		r.linkURLs = append(r.linkURLs, target)
+		ref = len(r.linkURLs)
+		r.linkRefs[target] = ref
+	}
+
+	switch r.links {
+	case LinkReference:
+		return fmt.Sprintf("[%s][%d]", text, ref)
+	case LinkFootnote:
+		return fmt.Sprintf("%s[^%d]", text, ref)
+	}
+	return fmt.Sprintf("[%s](%s)", text, target)
+}
+
+// linkDefinitions renders the reference or footnote definitions for the links used so far.
+func (r *markdownRenderer) linkDefinitions() string {
+	if r.links != LinkReference && r.links != LinkFootnote {
+		return ""
+	}
+	format := "[%d]: %s"
+	if r.links == LinkFootnote {
+		format = "[^%d]: %s"
+	}
+	lines := make([]string, len(r.linkURLs))
+	for i, target := range r.linkURLs {
+		lines[i] = fmt.Sprintf(format, i+1, target)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (r *markdownRenderer) image(n *html.Node) string {
+	src := getAttr(n, "src")
+	if src == "" {
+		src = getAttr(n, "data-src") // Lazy loaders
+	}
+	if src == "" || strings.HasPrefix(src, "data:") {
+		return ""
+	}
+	alt := escapeMarkdown(strings.Join(strings.Fields(getAttr(n, "alt")), " "))
+	return fmt.Sprintf("![%s](%s)", alt, r.resolve(src))
+}
+
+// resolve makes href absolute against the page and safe to put inside (...).
+func (r *markdownRenderer) resolve(href string) string {
+	// Resolve relative URLs
+	if r.base != nil {
+		if u, err := url.Parse(href); err == nil {
+			href = r.base.ResolveReference(u).String()
+		}
+	}
+	return strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29", "<", "%3C", ">", "%3E").Replace(href)
+}
+
+// codeBlock renders <pre> as a fenced block, keeping whitespace exactly.
+func (r *markdownRenderer) codeBlock(n *html.Node) string {
+	code := strings.Trim(rawText(n), "\n")
+
+	lang := ""
+	for _, el := range append([]*html.Node{n}, findAll(n, "code")...) {
+		if m := reCodeLanguage.FindStringSubmatch(getAttr(el, "class")); m != nil {
+			lang = m[1]
+			break
+		}
+	}
+
+	// The fence must be longer than any backtick run in the code
+	fence := "```"
+	for _, run := range reBacktickRun.FindAllString(code, -1) {
+		if len(run) >= len(fence) {
+			fence = strings.Repeat("`", len(run)+1)
+		}
+	}
+	return fence + lang + "\n" + code + "\n" + fence
+}
+
+// list renders ul/ol with numbering and nested indentation.
+func (r *markdownRenderer) list(n *html.Node) string {
+	ordered := n.Data == "ol"
+	number := 1
+	if start, err := strconv.Atoi(getAttr(n, "start")); err == nil {
+		number = start
+	}
+
+	var items []string
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+
+		// Lists nested directly in lists belong to the previous item
+		if (c.Data == "ul" || c.Data == "ol") && len(items) > 0 {
+			if nested := r.list(c); nested != "" {
+				indent := strings.Repeat(" ", listIndent(items[len(items)-1]))
+				items[len(items)-1] += "\n" + prefixLines(nested, indent, indent)
+			}
+			continue
+		}
+		if c.Data != "li" {
+			continue
+		}
+
+		marker := "- "
+		if ordered {
+			marker = strconv.Itoa(number) + ". "
+			number++
+		}
+
+		blocks := r.blocks(c)
+		var content strings.Builder
+		for i, b := range blocks {
+			if i > 0 {
+				// Keep a nested list tight to its item's text
+				if strings.HasPrefix(b, "- ") || reLineOrdered.MatchString(b) {
+					content.WriteString("\n")
+				} else {
+					content.WriteString("\n\n")
+				}
+			}
+			content.WriteString(b)
+		}
+
+		if content.Len() == 0 {
+			items = append(items, strings.TrimSpace(marker))
+			continue
+		}
+		items = append(items, prefixLines(content.String(), marker, strings.Repeat(" ", len(marker))))
+	}
+	return strings.Join(items, "\n")
+}
+
+// definitionList renders a dl as each term in bold followed by a bullet list of its
+// definitions, since CommonMark has no definition lists of its own.
+func (r *markdownRenderer) definitionList(n *html.Node) string {
+	var blocks, definitions []string
+	flush := func() {
+		if len(definitions) > 0 {
+			blocks = append(blocks, strings.Join(definitions, "\n"))
+			definitions = nil
+		}
+	}
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			switch c.Data {
+			case "dd":
+				if inner := strings.Join(r.blocks(c), "\n\n"); inner != "" {
+					definitions = append(definitions, prefixLines(inner, "- ", "  "))
+				}
+			case "div":
+				walk(c) // HTML allows grouping a term with its definitions
+			default:
+				flush()
+				blocks = append(blocks, r.block(c)...)
+			}
+		}
+	}
+	walk(n)
+	flush()
+	return strings.Join(blocks, "\n\n")
+}
+
+// table renders a data table as a GFM table, expanding colspans.
+func (r *markdownRenderer) table(n *html.Node) string {
+	var rows [][]string
+	headerRow := false
+	for _, tr := range tableRows(n) {
+		var cells []string
+		allHeaders := true
+		for c := tr.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode || (c.Data != "td" && c.Data != "th") {
+				continue
+			}
+			if c.Data == "td" {
+				allHeaders = false
+			}
+			text := strings.Join(strings.Fields(r.inlineChildren(c)), " ")
+			if !r.plain {
+				text = strings.ReplaceAll(text, "|", `\|`)
+			}
+			cells = append(cells, text)
+			if span, err := strconv.Atoi(getAttr(c, "colspan")); err == nil && span > 1 {
+				for i := 1; i < min(span, 100); i++ {
+					cells = append(cells, "")
+				}
+			}
+		}
+		if len(cells) == 0 {
+			continue
+		}
+		if len(rows) == 0 && (allHeaders || hasAncestorTag(tr, "thead")) {
+			headerRow = true
+		}
+		rows = append(rows, cells)
+	}
+	if len(rows) == 0 {
+		return ""
+	}
+
+	columns := 0
+	for _, row := range rows {
+		columns = max(columns, len(row))
+	}
+
+	caption := ""
+	if captions := findAll(n, "caption"); len(captions) > 0 {
+		caption = strings.Join(strings.Fields(r.inlineChildren(captions[0])), " ")
+	}
+
+	if r.plain {
+		lines := []string{}
+		if caption != "" {
+			lines = append(lines, caption)
+		}
+		for _, row := range rows {
+			lines = append(lines, strings.Join(row, "\t"))
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	// GFM requires a header; without one, an empty header keeps every data row as data
+	if !headerRow {
+		rows = append([][]string{make([]string, columns)}, rows...)
+	}
+
+	var sb strings.Builder
+	if caption != "" {
+		sb.WriteString("*" + caption + "*\n\n")
+	}
+	for i, row := range rows {
+		for len(row) < columns {
+			row = append(row, "")
+		}
+		sb.WriteString("| " + strings.Join(row, " | ") + " |\n")
+		if i == 0 {
+			sb.WriteString("|" + strings.Repeat(" --- |", columns) + "\n")
+		}
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// tableRows returns the rows that belong to table itself, not to nested tables.
+func tableRows(table *html.Node) []*html.Node {
+	var rows []*html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			switch c.Data {
+			case "tr":
+				rows = append(rows, c)
+			case "thead", "tbody", "tfoot":
+				walk(c)
+			}
+		}
+	}
+	walk(table)
+	return rows
+}
+
+// rawText returns the text under n with whitespace untouched and <br> as a newline.
+func rawText(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(node *html.Node) {
+		switch {
+		case node.Type == html.TextNode:
+			sb.WriteString(node.Data)
+		case node.Type == html.ElementNode && node.Data == "br":
+			sb.WriteString("\n")
+		}
+		for c := node.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return sb.String()
+}
+
+// paragraph tidies an inline run into a paragraph, guarding line starts that
+// would otherwise be read back as block syntax.
+func (r *markdownRenderer) paragraph(inline string) string {
+	lines := strings.Split(inline, "\n")
+	var kept []string
+	for _, line := range lines {
+		line = strings.TrimSpace(reSpaces.ReplaceAllString(line, " "))
+		if line == "" {
+			continue
+		}
+		if r.plain {
+			kept = append(kept, line)
+			continue
+		}
+		if reLineBlockMark.MatchString(line) {
+			line = `\` + line
+		} else if m := reLineOrdered.FindStringSubmatchIndex(line); m != nil {
+			line = line[:m[3]] + `\` + line[m[3]:]
+		}
+		kept = append(kept, line)
+	}
+	return strings.Join(kept, "\n")
+}
+
+// wrapInline surrounds content with a delimiter, keeping edge spaces outside it so
+// the delimiter run stays left/right-flanking.
+func wrapInline(content, delim string) string {
+	trimmed := strings.TrimSpace(content)
+	if trimmed == "" {
+		return content
+	}
+	lead := content[:len(content)-len(strings.TrimLeft(content, " \n"))]
+	trail := content[len(strings.TrimRight(content, " \n")):]
+	return lead + delim + trimmed + delim + trail
+}
+
+// inlineCode wraps code in a backtick string longer than any run inside it.
+func inlineCode(code string) string {
+	code = strings.Join(strings.Fields(code), " ")
+	if code == "" {
+		return ""
+	}
+	fence := "`"
+	for _, run := range reBacktickRun.FindAllString(code, -1) {
+		if len(run) >= len(fence) {
+			fence = strings.Repeat("`", len(run)+1)
+		}
+	}
+	if strings.HasPrefix(code, "`") || strings.HasSuffix(code, "`") {
+		code = " " + code + " "
+	}
+	return fence + code + fence
+}
+
+// escapeMarkdown backslash-escapes characters that would change meaning as Markdown.
+func escapeMarkdown(text string) string {
+	var sb strings.Builder
+	runes := []rune(text)
+	for i, c := range runes {
+		switch c {
+		case '\\', '*', '`', '[', ']':
+			sb.WriteRune('\\')
+		case '_':
+			// snake_case never forms emphasis, so leave intraword underscores alone
+			if i == 0 || i == len(runes)-1 || !isWordRune(runes[i-1]) || !isWordRune(runes[i+1]) {
+				sb.WriteRune('\\')
+			}
+		case '<':
+			if i+1 < len(runes) && (isWordRune(runes[i+1]) || runes[i+1] == '/' || runes[i+1] == '!' || runes[i+1] == '?') {
+				sb.WriteRune('\\')
+			}
+		case '~':
+			if i+1 < len(runes) && runes[i+1] == '~' {
+				sb.WriteRune('\\')
+			}
+		}
+		sb.WriteRune(c)
+	}
+	return reEntityLike.ReplaceAllString(sb.String(), `\&$1;`)
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || r > 127
+}
+
+// prefixLines puts first before the first line and rest before every following
+// non-empty line.
+func prefixLines(text, first, rest string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		switch {
+		case i == 0:
+			lines[i] = first + line
+		case line == "":
+			lines[i] = strings.TrimRight(rest, " ")
+		default:
+			lines[i] = rest + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// listIndent is the content indentation of a rendered list item.
+func listIndent(item string) int {
+	if strings.HasPrefix(item, "- ") {
+		return 2
+	}
+	if m := reLineOrdered.FindStringSubmatch(item); m != nil {
+		return len(m[1]) + 2
+	}
+	return 2
+}
+
+func cleanMarkdown(raw string) string {
+	// Trim trailing whitespace and collapse blank-line runs, but never inside a
+	// fenced code block where whitespace is content.
+	var out []string
+	fence := ""
+	blank := 0
+	for _, line := range strings.Split(raw, "\n") {
+		if fence != "" {
+			out = append(out, line)
+			if strings.TrimSpace(line) == fence {
+				fence = ""
+			}
+			continue
+		}
+
+		line = strings.TrimRight(line, " \t")
+		if trimmed := strings.TrimLeft(line, " "); strings.HasPrefix(trimmed, "```") {
+			fence = trimmed[:len(trimmed)-len(strings.TrimLeft(trimmed, "`"))]
+		}
+		if reEmptyHeading.MatchString(line) { // Remove empty headers
+			continue
+		}
+		if line == "" {
+			blank++
+			if blank > 1 {
+				continue
+			}
+		} else {
+			blank = 0
+		}
+		out = append(out, line)
+	}
+
+	// Final trim for leading/trailing document whitespace
+	return strings.Trim(strings.Join(out, "\n"), "\n")
+}
@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// Each case's Markdown must read back as the same structure under CommonMark (plus
+// GFM tables): text stays text, and blocks keep their kind and nesting.
+func TestMarkdownRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{
+			name: "emphasis and link characters",
+			html: `<p>2 * 3 * 4 and _under_ and snake_case and [not a link] and a\b</p>`,
+			want: `2 \* 3 \* 4 and \_under\_ and snake_case and \[not a link\] and a\\b`,
+		},
+		{
+			name: "heading marker at line start",
+			html: `<p># not a heading</p>`,
+			want: `\# not a heading`,
+		},
+		{
+			name: "ordered list marker at line start",
+			html: `<p>1. not a list</p><p>2) nor this</p>`,
+			want: "1\\. not a list\n\n2\\) nor this",
+		},
+		{
+			name: "bullet markers at line start",
+			html: `<p>- not a bullet</p><p>+ nor this</p>`,
+			want: "\\- not a bullet\n\n\\+ nor this",
+		},
+		{
+			name: "setext underline after a line break",
+			html: `<p>Title<br>=====</p>`,
+			want: "Title\n\\=====",
+		},
+		{
+			name: "fence containing backticks",
+			html: "<pre><code class=\"language-go\">x := \"```\"\ny := `a`</code></pre>",
+			want: "````go\nx := \"```\"\ny := `a`\n````",
+		},
+		{
+			name: "inline code containing a backtick",
+			html: "<p>Use <code>a`b</code> here</p>",
+			want: "Use ``a`b`` here",
+		},
+		{
+			name: "nested lists",
+			html: `<ul><li>One<ul><li>Nested</li></ul></li><li>Two</li></ul>`,
+			want: "- One\n  - Nested\n- Two",
+		},
+		{
+			name: "ordered list with start",
+			html: `<ol start="3"><li>Three</li><li>Four<ol><li>Inner</li></ol></li></ol>`,
+			want: "3. Three\n4. Four\n   1. Inner",
+		},
+		{
+			name: "pipe in a table cell",
+			html: `<table><thead><tr><th>Expr</th><th>Meaning</th></tr></thead><tbody><tr><td>a | b</td><td>or</td></tr></tbody></table>`,
+			want: "| Expr | Meaning |\n| --- | --- |\n| a \\| b | or |",
+		},
+		{
+			name: "code block in a blockquote",
+			html: "<blockquote><p>Quote</p><pre><code>line 1\n\nline 3</code></pre></blockquote>",
+			want: "> Quote\n>\n> ```\n> line 1\n>\n> line 3\n> ```",
+		},
+		{
+			name: "definition list",
+			html: `<dl><dt>Term</dt><dd>Def one</dd><dd>Def two</dd><dt>Other</dt><dd><p>Para</p><p>Second</p></dd></dl>`,
+			want: "**Term**\n\n- Def one\n- Def two\n\n**Other**\n\n- Para\n\n  Second",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader(tt.html))
+			if err != nil {
+				t.Fatal(err)
+			}
+			e := &Extraction{Node: findAll(doc, "body")[0], PageURL: "https://example.com/"}
+			if got := e.MarkdownWith(MarkdownOptions{}); got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
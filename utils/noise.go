@@ -0,0 +1,210 @@
+package utils
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/EasterCompany/dex-web-service/config"
+	"golang.org/x/net/html"
+)
+
+// Built-in class/id words for page furniture: the old cleanDOM list plus Readability's
+// unlikely candidates. Extended or replaced by the noise section of the rules file.
+var defaultNegativeNoise = []string{
+	"sidebar", "comment", "popup", "cookie", "ad", "ads", "advert", "advertisement", "widget",
+	"promo", "newsletter", "trending", "related", "popular", "social", "share", "sharing",
+	"more-from", "ai2html", "banner", "breadcrumb", "breadcrumbs", "combx", "community",
+	"cover-wrap", "disqus", "extra", "footer", "gdpr", "header", "legends", "menu", "remark",
+	"replies", "rss", "shoutbox", "skyscraper", "sponsor", "sponsored", "supplemental",
+	"ad-break", "agegate", "pagination", "pager", "yom-remote",
+}
+
+// Words that keep an element even when a negative word matches, as in Readability
+var defaultPositiveNoise = []string{
+	"article", "body", "column", "content", "main", "mathjax", "shadow",
+}
+
+// Class/id words that weigh a candidate down or up when scoring, as in Readability.js.
+// The configured noise words count too.
+var (
+	defaultNegativeWeight = []string{
+		"ad", "hidden", "hid", "banner", "combx", "comment", "com", "contact", "footer", "gdpr",
+		"masthead", "media", "meta", "outbrain", "promo", "related", "scroll", "share", "shoutbox",
+		"sidebar", "skyscraper", "sponsor", "shopping", "tags", "widget",
+	}
+	defaultPositiveWeight = []string{
+		"article", "body", "content", "entry", "hentry", "h-entry", "main", "page", "pagination",
+		"post", "text", "blog", "story",
+	}
+)
+
+// Share of the page's text above which an element is never removed as noise
+const noiseProtectedTextShare = 0.5
+
+// noiseMatcher holds compiled noise rules. Each rule is a sequence of words.
+type noiseMatcher struct {
+	negative [][]string
+	positive [][]string
+
+	negativeWeight [][]string // For classWeight
+	positiveWeight [][]string
+}
+
+var (
+	noiseMu      sync.Mutex
+	noiseSource  *config.ExtractionRules
+	noiseCurrent *noiseMatcher
+)
+
+// currentNoiseMatcher compiles the configured noise rules, recompiling when the rules file reloads.
+func currentNoiseMatcher() *noiseMatcher {
+	rules := config.GetExtractionRules()
+
+	noiseMu.Lock()
+	defer noiseMu.Unlock()
+	if noiseCurrent != nil && noiseSource == rules {
+		return noiseCurrent
+	}
+
+	negative, positive := rules.Noise.Negative, rules.Noise.Positive
+	negativeWeight, positiveWeight := rules.Noise.Negative, rules.Noise.Positive
+	if !rules.Noise.ReplaceDefaults {
+		negative = append(append([]string(nil), defaultNegativeNoise...), negative...)
+		positive = append(append([]string(nil), defaultPositiveNoise...), positive...)
+		negativeWeight = append(append([]string(nil), defaultNegativeWeight...), negativeWeight...)
+		positiveWeight = append(append([]string(nil), defaultPositiveWeight...), positiveWeight...)
+	}
+	noiseCurrent = &noiseMatcher{
+		negative:       compileNoiseRules(negative),
+		positive:       compileNoiseRules(positive),
+		negativeWeight: compileNoiseRules(negativeWeight),
+		positiveWeight: compileNoiseRules(positiveWeight),
+	}
+	noiseSource = rules
+	return noiseCurrent
+}
+
+func compileNoiseRules(rules []string) [][]string {
+	var compiled [][]string
+	for _, rule := range rules {
+		if words := identifierWords(rule); len(words) > 0 {
+			compiled = append(compiled, words)
+		}
+	}
+	return compiled
+}
+
+// isNoise reports whether n's class or id has a negative word and no positive one.
+func (m *noiseMatcher) isNoise(n *html.Node) bool {
+	tokens := identifierTokens(getAttr(n, "class") + " " + getAttr(n, "id"))
+	return matchesNoiseRule(tokens, m.negative) && !matchesNoiseRule(tokens, m.positive)
+}
+
+// weight scores one class or id value: -25 for a negative word, +25 for a positive one.
+func (m *noiseMatcher) weight(value string) int {
+	tokens := identifierTokens(value)
+	weight := 0
+	if matchesNoiseRule(tokens, m.negativeWeight) {
+		weight -= 25
+	}
+	if matchesNoiseRule(tokens, m.positiveWeight) {
+		weight += 25
+	}
+	return weight
+}
+
+// identifierTokens splits a class list or id into tokens, each as its words.
+func identifierTokens(value string) [][]string {
+	var tokens [][]string
+	for _, token := range strings.Fields(value) {
+		tokens = append(tokens, identifierWords(token))
+	}
+	return tokens
+}
+
+// matchesNoiseRule reports whether any rule's words appear in a row within one token.
+// A trailing "s" on the token's word is allowed, so "comment" matches "comments".
+func matchesNoiseRule(tokens, rules [][]string) bool {
+	for _, words := range tokens {
+		for _, rule := range rules {
+			for start := 0; start+len(rule) <= len(words); start++ {
+				matched := true
+				for i, want := range rule {
+					if got := words[start+i]; got != want && got != want+"s" {
+						matched = false
+						break
+					}
+				}
+				if matched {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// identifierWords splits a class name or id into lowercase words at punctuation,
+// digits and camelCase boundaries: "shareBar_2" -> share, bar.
+func identifierWords(s string) []string {
+	var words []string
+	var word []rune
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, strings.ToLower(string(word)))
+			word = word[:0]
+		}
+	}
+	var prev rune
+	for _, r := range s {
+		switch {
+		case !unicode.IsLetter(r):
+			flush()
+		case unicode.IsUpper(r) && unicode.IsLower(prev):
+			flush()
+			word = append(word, r)
+		default:
+			word = append(word, r)
+		}
+		prev = r
+	}
+	flush()
+	return words
+}
+
+// isHiddenElement reports whether n is hidden by the hidden attribute,
+// aria-hidden="true" or an inline display:none / visibility:hidden.
+func isHiddenElement(n *html.Node) bool {
+	for _, attr := range n.Attr {
+		switch attr.Key {
+		case "hidden":
+			return true
+		case "aria-hidden":
+			if strings.EqualFold(strings.TrimSpace(attr.Val), "true") {
+				return true
+			}
+		case "style":
+			style := strings.ToLower(strings.Join(strings.Fields(attr.Val), ""))
+			if strings.Contains(style, "display:none") || strings.Contains(style, "visibility:hidden") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// visibleTextLength counts the characters of n's text outside scripts and styles.
+func visibleTextLength(n *html.Node) int {
+	switch {
+	case n.Type == html.TextNode:
+		return len(strings.TrimSpace(n.Data))
+	case n.Type == html.ElementNode && nonContentTags[n.Data]:
+		return 0
+	}
+	total := 0
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		total += visibleTextLength(c)
+	}
+	return total
+}
@@ -0,0 +1,788 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ErrDocumentMalformed wraps failures to read a DOCX, ODT or EPUB file.
+var ErrDocumentMalformed = errors.New("malformed document")
+
+// Largest part of a zip-based document that is decompressed
+const maxDocumentPartSize = 64 << 20
+
+// xmlNode is a namespace-free XML tree. Elements have a name; text nodes don't.
+type xmlNode struct {
+	name     string
+	attrs    map[string]string
+	children []*xmlNode
+	text     string
+}
+
+// parseXMLTree reads an XML document into a tree keyed by local names, so w:p is "p"
+// and text:style-name is "style-name".
+func parseXMLTree(data []byte) (*xmlNode, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	dec.Entity = xml.HTMLEntity
+
+	root := &xmlNode{}
+	stack := []*xmlNode{root}
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDocumentMalformed, err)
+		}
+		parent := stack[len(stack)-1]
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{name: t.Name.Local, attrs: make(map[string]string, len(t.Attr))}
+			for _, a := range t.Attr {
+				n.attrs[a.Name.Local] = a.Value
+			}
+			parent.children = append(parent.children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			parent.children = append(parent.children, &xmlNode{text: string(t)})
+		}
+	}
+	return root, nil
+}
+
+// child returns n's first child element called name.
+func (n *xmlNode) child(name string) *xmlNode {
+	if n == nil {
+		return nil
+	}
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// find returns the first element called name at or below n, depth first.
+func (n *xmlNode) find(name string) *xmlNode {
+	if n == nil {
+		return nil
+	}
+	if n.name == name {
+		return n
+	}
+	for _, c := range n.children {
+		if found := c.find(name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// findAll returns every element called name below n, in document order.
+func (n *xmlNode) findAll(name string) []*xmlNode {
+	var found []*xmlNode
+	for _, c := range n.children {
+		if c.name == name {
+			found = append(found, c)
+		}
+		found = append(found, c.findAll(name)...)
+	}
+	return found
+}
+
+// textContent concatenates the text below n.
+func (n *xmlNode) textContent() string {
+	if n == nil {
+		return ""
+	}
+	if n.name == "" {
+		return n.text
+	}
+	var b strings.Builder
+	for _, c := range n.children {
+		b.WriteString(c.textContent())
+	}
+	return b.String()
+}
+
+// attr returns n's attribute key, or "" when n is nil.
+func (n *xmlNode) attr(key string) string {
+	if n == nil {
+		return ""
+	}
+	return n.attrs[key]
+}
+
+// readZipPart returns the decompressed contents of the named zip entry.
+func readZipPart(zr *zip.Reader, name string) ([]byte, error) {
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDocumentMalformed, err)
+		}
+		defer func() { _ = rc.Close() }()
+		data, err := io.ReadAll(io.LimitReader(rc, maxDocumentPartSize))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDocumentMalformed, err)
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("%w: missing %s", ErrDocumentMalformed, name)
+}
+
+// readZipXML parses the named zip entry as XML.
+func readZipXML(zr *zip.Reader, name string) (*xmlNode, error) {
+	data, err := readZipPart(zr, name)
+	if err != nil {
+		return nil, err
+	}
+	return parseXMLTree(data)
+}
+
+// zipDocumentType identifies a DOCX, ODT or EPUB file from its entries.
+func zipDocumentType(body []byte) string {
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return ""
+	}
+	for _, f := range zr.File {
+		switch f.Name {
+		case "word/document.xml":
+			return "docx"
+		case "mimetype":
+			data, err := readZipPart(zr, "mimetype")
+			if err != nil {
+				return ""
+			}
+			switch strings.TrimSpace(string(data)) {
+			case "application/vnd.oasis.opendocument.text":
+				return "odt"
+			case "application/epub+zip":
+				return "epub"
+			}
+		}
+	}
+	return ""
+}
+
+// openZipDocument opens a zip-based document held in memory.
+func openZipDocument(data []byte) (*zip.Reader, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDocumentMalformed, err)
+	}
+	return zr, nil
+}
+
+// htmlText returns a text node.
+func htmlText(s string) *html.Node {
+	return &html.Node{Type: html.TextNode, Data: s}
+}
+
+// headingAtoms are the atoms of h1 to h6, by level.
+var headingAtoms = []atom.Atom{atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6}
+
+func newHeading(level int) *html.Node {
+	level = min(max(level, 1), 6)
+	return newElement("h"+strconv.Itoa(level), headingAtoms[level-1])
+}
+
+// documentLists nests list items the way a flat run of numbered paragraphs describes:
+// each item has a level and an ordered flag, and items of deeper levels go inside
+// the previous item.
+type documentLists struct {
+	parent *html.Node
+	stack  []*html.Node // Open ul/ol elements, outermost first
+}
+
+// add appends item at level (0-based) to the open lists, opening and closing lists as needed.
+func (l *documentLists) add(item *html.Node, level int, ordered bool) {
+	level = min(max(level, 0), 8)
+	tag, a := "ul", atom.Ul
+	if ordered {
+		tag, a = "ol", atom.Ol
+	}
+	if len(l.stack) > level+1 {
+		l.stack = l.stack[:level+1]
+	}
+	if len(l.stack) == level+1 && l.stack[level].Data != tag {
+		l.stack = l.stack[:level]
+	}
+	for len(l.stack) < level+1 {
+		list := newElement(tag, a)
+		if len(l.stack) == 0 {
+			l.parent.AppendChild(list)
+		} else {
+			outer := l.stack[len(l.stack)-1]
+			if outer.LastChild == nil {
+				outer.AppendChild(newElement("li", atom.Li))
+			}
+			outer.LastChild.AppendChild(list)
+		}
+		l.stack = append(l.stack, list)
+	}
+	l.stack[level].AppendChild(item)
+}
+
+// close ends the open lists; the next item starts a new one.
+func (l *documentLists) close() {
+	l.stack = l.stack[:0]
+}
+
+// documentTable builds a table whose header rows become a thead of th cells. When no
+// row is marked as a header the first row is used, as documents almost always have one.
+type documentTable struct {
+	header []*html.Node
+	body   []*html.Node
+}
+
+func (t *documentTable) addRow(cells []*html.Node, header bool) {
+	tr := newElement("tr", atom.Tr)
+	for _, cell := range cells {
+		tr.AppendChild(cell)
+	}
+	if header && len(t.body) == 0 {
+		t.header = append(t.header, tr)
+	} else {
+		t.body = append(t.body, tr)
+	}
+}
+
+func (t *documentTable) build() *html.Node {
+	table := newElement("table", atom.Table)
+	if len(t.header) == 0 && len(t.body) > 0 {
+		t.header, t.body = t.body[:1], t.body[1:]
+	}
+	if len(t.header) > 0 {
+		thead := newElement("thead", atom.Thead)
+		for _, tr := range t.header {
+			for c := tr.FirstChild; c != nil; c = c.NextSibling {
+				setNodeTag(c, "th", atom.Th)
+			}
+			thead.AppendChild(tr)
+		}
+		table.AppendChild(thead)
+	}
+	tbody := newElement("tbody", atom.Tbody)
+	for _, tr := range t.body {
+		tbody.AppendChild(tr)
+	}
+	table.AppendChild(tbody)
+	return table
+}
+
+// newCell returns a td holding the given paragraphs' inline content, one per line.
+func newCell(paragraphs []*html.Node, colspan, rowspan int) *html.Node {
+	td := newElement("td", atom.Td)
+	if colspan > 1 {
+		td.Attr = append(td.Attr, html.Attribute{Key: "colspan", Val: strconv.Itoa(colspan)})
+	}
+	if rowspan > 1 {
+		td.Attr = append(td.Attr, html.Attribute{Key: "rowspan", Val: strconv.Itoa(rowspan)})
+	}
+	for i, p := range paragraphs {
+		if i > 0 {
+			td.AppendChild(newElement("br", atom.Br))
+		}
+		for c := p.FirstChild; c != nil; {
+			next := c.NextSibling
+			p.RemoveChild(c)
+			td.AppendChild(c)
+			c = next
+		}
+	}
+	return td
+}
+
+// wrapInlineNode returns child inside a new tag element.
+func wrapInlineNode(child *html.Node, tag string, a atom.Atom) *html.Node {
+	el := newElement(tag, a)
+	el.AppendChild(child)
+	return el
+}
+
+// ---- DOCX ----
+
+// docxStyle is what a paragraph style contributes: a heading level or list numbering.
+type docxStyle struct {
+	heading int // 1-6, or 0
+	numID   string
+	ilvl    int
+}
+
+type docxConverter struct {
+	styles    map[string]docxStyle
+	ordered   map[string]map[int]bool // numId -> level -> numbered rather than bulleted
+	hyperlink map[string]string       // Relationship id -> external URL
+}
+
+// extractDOCX converts word/document.xml to HTML and reads docProps/core.xml.
+func extractDOCX(data []byte) (*DocumentInfo, error) {
+	zr, err := openZipDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	document, err := readZipXML(zr, "word/document.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	c := &docxConverter{
+		styles:    make(map[string]docxStyle),
+		ordered:   make(map[string]map[int]bool),
+		hyperlink: make(map[string]string),
+	}
+	// Styles, numbering and relationships are optional parts
+	if styles, err := readZipXML(zr, "word/styles.xml"); err == nil {
+		c.readStyles(styles)
+	}
+	if numbering, err := readZipXML(zr, "word/numbering.xml"); err == nil {
+		c.readNumbering(numbering)
+	}
+	if rels, err := readZipXML(zr, "word/_rels/document.xml.rels"); err == nil {
+		for _, rel := range rels.findAll("Relationship") {
+			if rel.attr("TargetMode") == "External" {
+				c.hyperlink[rel.attr("Id")] = rel.attr("Target")
+			}
+		}
+	}
+
+	info := &DocumentInfo{Type: "docx"}
+	if core, err := readZipXML(zr, "docProps/core.xml"); err == nil {
+		info.Title = strings.TrimSpace(core.find("title").textContent())
+		info.Author = strings.TrimSpace(core.find("creator").textContent())
+		info.Subject = strings.TrimSpace(core.find("subject").textContent())
+		info.Created = strings.TrimSpace(core.find("created").textContent())
+		info.Modified = strings.TrimSpace(core.find("modified").textContent())
+	}
+
+	article := newElement("article", atom.Article)
+	c.blocks(document.find("body"), &documentLists{parent: article})
+	info.content = article
+	return info, nil
+}
+
+func (c *docxConverter) readStyles(styles *xmlNode) {
+	for _, s := range styles.findAll("style") {
+		var style docxStyle
+		name := strings.ToLower(s.child("name").attr("val"))
+		switch {
+		case name == "title":
+			style.heading = 1
+		case strings.HasPrefix(name, "heading "):
+			style.heading, _ = strconv.Atoi(strings.TrimPrefix(name, "heading "))
+		}
+		pPr := s.child("pPr")
+		if lvl, err := strconv.Atoi(pPr.child("outlineLvl").attr("val")); err == nil && style.heading == 0 && lvl < 6 {
+			style.heading = lvl + 1
+		}
+		if numPr := pPr.child("numPr"); numPr != nil {
+			style.numID = numPr.child("numId").attr("val")
+			style.ilvl, _ = strconv.Atoi(numPr.child("ilvl").attr("val"))
+		}
+		c.styles[s.attr("styleId")] = style
+	}
+}
+
+func (c *docxConverter) readNumbering(numbering *xmlNode) {
+	abstract := make(map[string]map[int]bool)
+	for _, a := range numbering.findAll("abstractNum") {
+		levels := make(map[int]bool)
+		for _, lvl := range a.findAll("lvl") {
+			ilvl, _ := strconv.Atoi(lvl.attr("ilvl"))
+			format := lvl.child("numFmt").attr("val")
+			levels[ilvl] = format != "" && format != "bullet" && format != "none"
+		}
+		abstract[a.attr("abstractNumId")] = levels
+	}
+	for _, num := range numbering.findAll("num") {
+		c.ordered[num.attr("numId")] = abstract[num.child("abstractNumId").attr("val")]
+	}
+}
+
+// blocks converts the paragraphs and tables under n, appending them to lists.parent.
+func (c *docxConverter) blocks(n *xmlNode, lists *documentLists) {
+	if n == nil {
+		return
+	}
+	for _, child := range n.children {
+		switch child.name {
+		case "p":
+			c.paragraph(child, lists)
+		case "tbl":
+			lists.close()
+			lists.parent.AppendChild(c.table(child))
+		case "sdt":
+			c.blocks(child.child("sdtContent"), lists)
+		case "customXml", "ins":
+			c.blocks(child, lists)
+		}
+	}
+}
+
+func (c *docxConverter) paragraph(p *xmlNode, lists *documentLists) {
+	pPr := p.child("pPr")
+	style := c.styles[pPr.child("pStyle").attr("val")]
+	numID, ilvl := style.numID, style.ilvl
+	if numPr := pPr.child("numPr"); numPr != nil {
+		numID = numPr.child("numId").attr("val")
+		ilvl, _ = strconv.Atoi(numPr.child("ilvl").attr("val"))
+	}
+	heading := style.heading
+	if lvl, err := strconv.Atoi(pPr.child("outlineLvl").attr("val")); err == nil && lvl < 6 {
+		heading = lvl + 1
+	}
+
+	var el *html.Node
+	switch {
+	case heading > 0:
+		el = newHeading(heading)
+	case numID != "" && numID != "0":
+		el = newElement("li", atom.Li)
+	default:
+		el = newElement("p", atom.P)
+	}
+	c.inline(p, el)
+	if strings.TrimSpace(innerText(el)) == "" {
+		return
+	}
+
+	if el.Data == "li" {
+		lists.add(el, ilvl, c.ordered[numID][ilvl])
+		return
+	}
+	lists.close()
+	lists.parent.AppendChild(el)
+}
+
+// inline appends the runs and links under n to parent.
+func (c *docxConverter) inline(n *xmlNode, parent *html.Node) {
+	for _, child := range n.children {
+		switch child.name {
+		case "r":
+			c.run(child, parent)
+		case "hyperlink":
+			target := parent
+			if href := c.hyperlink[child.attr("id")]; href != "" {
+				target = newElement("a", atom.A)
+				target.Attr = []html.Attribute{{Key: "href", Val: href}}
+				parent.AppendChild(target)
+			}
+			c.inline(child, target)
+		case "ins", "smartTag", "fldSimple", "customXml":
+			c.inline(child, parent)
+		case "sdt":
+			c.inline(child.child("sdtContent"), parent)
+		}
+	}
+}
+
+func (c *docxConverter) run(r *xmlNode, parent *html.Node) {
+	var text strings.Builder
+	var nodes []*html.Node
+	flush := func() {
+		if text.Len() > 0 {
+			nodes = append(nodes, htmlText(text.String()))
+			text.Reset()
+		}
+	}
+	for _, child := range r.children {
+		switch child.name {
+		case "t":
+			text.WriteString(child.textContent())
+		case "tab":
+			text.WriteString(" ")
+		case "noBreakHyphen":
+			text.WriteString("-")
+		case "br", "cr":
+			flush()
+			nodes = append(nodes, newElement("br", atom.Br))
+		}
+	}
+	flush()
+
+	rPr := r.child("rPr")
+	for _, node := range nodes {
+		if node.Type == html.TextNode {
+			if docxToggle(rPr.child("i")) {
+				node = wrapInlineNode(node, "em", atom.Em)
+			}
+			if docxToggle(rPr.child("b")) {
+				node = wrapInlineNode(node, "strong", atom.Strong)
+			}
+		}
+		parent.AppendChild(node)
+	}
+}
+
+// docxToggle reports whether an on/off property such as <w:b/> is on.
+func docxToggle(n *xmlNode) bool {
+	if n == nil {
+		return false
+	}
+	switch n.attr("val") {
+	case "0", "false", "off":
+		return false
+	}
+	return true
+}
+
+func (c *docxConverter) table(tbl *xmlNode) *html.Node {
+	var t documentTable
+	for _, tr := range tbl.children {
+		if tr.name != "tr" {
+			continue
+		}
+		var cells []*html.Node
+		for _, tc := range tr.children {
+			if tc.name != "tc" {
+				continue
+			}
+			tcPr := tc.child("tcPr")
+			colspan, _ := strconv.Atoi(tcPr.child("gridSpan").attr("val"))
+
+			// Cells continuing a vertical merge are left empty
+			var paragraphs []*html.Node
+			if merge := tcPr.child("vMerge"); merge == nil || merge.attr("val") == "restart" {
+				for _, p := range tc.findAll("p") {
+					el := newElement("p", atom.P)
+					c.inline(p, el)
+					if strings.TrimSpace(innerText(el)) != "" {
+						paragraphs = append(paragraphs, el)
+					}
+				}
+			}
+			cells = append(cells, newCell(paragraphs, colspan, 0))
+		}
+		t.addRow(cells, tr.child("trPr").child("tblHeader") != nil)
+	}
+	return t.build()
+}
+
+// ---- ODT ----
+
+type odtConverter struct {
+	bold, italic map[string]bool         // Text style name -> property
+	ordered      map[string]map[int]bool // List style name -> level (1-based) -> numbered
+}
+
+// extractODT converts content.xml to HTML and reads meta.xml.
+func extractODT(data []byte) (*DocumentInfo, error) {
+	zr, err := openZipDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	content, err := readZipXML(zr, "content.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	c := &odtConverter{bold: make(map[string]bool), italic: make(map[string]bool), ordered: make(map[string]map[int]bool)}
+	if styles, err := readZipXML(zr, "styles.xml"); err == nil {
+		c.readStyles(styles)
+	}
+	c.readStyles(content) // Automatic styles
+
+	info := &DocumentInfo{Type: "odt"}
+	if meta, err := readZipXML(zr, "meta.xml"); err == nil {
+		info.Title = strings.TrimSpace(meta.find("title").textContent())
+		info.Author = strings.TrimSpace(meta.find("initial-creator").textContent())
+		if info.Author == "" {
+			info.Author = strings.TrimSpace(meta.find("creator").textContent())
+		}
+		info.Subject = strings.TrimSpace(meta.find("subject").textContent())
+		info.Created = strings.TrimSpace(meta.find("creation-date").textContent())
+		info.Modified = strings.TrimSpace(meta.find("date").textContent())
+	}
+
+	article := newElement("article", atom.Article)
+	c.blocks(content.find("body").child("text"), article)
+	info.content = article
+	return info, nil
+}
+
+func (c *odtConverter) readStyles(styles *xmlNode) {
+	for _, s := range styles.findAll("style") {
+		props := s.child("text-properties")
+		name := s.attr("name")
+		c.bold[name] = props.attr("font-weight") == "bold"
+		c.italic[name] = props.attr("font-style") == "italic"
+	}
+	for _, s := range styles.findAll("list-style") {
+		levels := make(map[int]bool)
+		for _, lvl := range s.children {
+			level, err := strconv.Atoi(lvl.attr("level"))
+			if err != nil {
+				continue
+			}
+			levels[level] = lvl.name == "list-level-style-number"
+		}
+		c.ordered[s.attr("name")] = levels
+	}
+}
+
+// blocks converts the headings, paragraphs, lists and tables under n, appending them to parent.
+func (c *odtConverter) blocks(n *xmlNode, parent *html.Node) {
+	if n == nil {
+		return
+	}
+	for _, child := range n.children {
+		switch child.name {
+		case "h":
+			level, _ := strconv.Atoi(child.attr("outline-level"))
+			c.appendIfText(parent, child, newHeading(max(level, 1)))
+		case "p":
+			c.appendIfText(parent, child, newElement("p", atom.P))
+		case "list":
+			parent.AppendChild(c.list(child, child.attr("style-name"), 1))
+		case "table":
+			parent.AppendChild(c.table(child))
+		case "section", "index-body", "table-of-content", "alphabetical-index", "illustration-index":
+			c.blocks(child, parent)
+		}
+	}
+}
+
+func (c *odtConverter) appendIfText(parent *html.Node, n *xmlNode, el *html.Node) {
+	c.inline(n, el)
+	if strings.TrimSpace(innerText(el)) != "" {
+		parent.AppendChild(el)
+	}
+}
+
+// list converts text:list; nested lists without a style of their own inherit the outer one.
+func (c *odtConverter) list(n *xmlNode, style string, level int) *html.Node {
+	if own := n.attr("style-name"); own != "" {
+		style = own
+	}
+	list := newElement("ul", atom.Ul)
+	if c.ordered[style][level] {
+		list = newElement("ol", atom.Ol)
+	}
+	for _, item := range n.children {
+		if item.name != "list-item" && item.name != "list-header" {
+			continue
+		}
+		li := newElement("li", atom.Li)
+		for _, child := range item.children {
+			switch child.name {
+			case "p", "h":
+				if li.FirstChild != nil {
+					li.AppendChild(newElement("br", atom.Br))
+				}
+				c.inline(child, li)
+			case "list":
+				li.AppendChild(c.list(child, style, level+1))
+			}
+		}
+		list.AppendChild(li)
+	}
+	return list
+}
+
+// inline appends the text, spans and links under n to parent.
+func (c *odtConverter) inline(n *xmlNode, parent *html.Node) {
+	for _, child := range n.children {
+		switch child.name {
+		case "":
+			parent.AppendChild(htmlText(child.text))
+		case "s":
+			count, err := strconv.Atoi(child.attr("c"))
+			if err != nil || count < 1 {
+				count = 1
+			}
+			parent.AppendChild(htmlText(strings.Repeat(" ", min(count, 100))))
+		case "tab":
+			parent.AppendChild(htmlText(" "))
+		case "line-break":
+			parent.AppendChild(newElement("br", atom.Br))
+		case "span":
+			target := parent
+			style := child.attr("style-name")
+			if c.bold[style] {
+				target = newElement("strong", atom.Strong)
+				parent.AppendChild(target)
+			}
+			if c.italic[style] {
+				em := newElement("em", atom.Em)
+				target.AppendChild(em)
+				target = em
+			}
+			c.inline(child, target)
+		case "a":
+			a := newElement("a", atom.A)
+			a.Attr = []html.Attribute{{Key: "href", Val: child.attr("href")}}
+			parent.AppendChild(a)
+			c.inline(child, a)
+		case "note", "annotation", "frame", "bookmark", "bookmark-start", "bookmark-end", "soft-page-break":
+			// Footnotes, comments and drawings aren't body text
+		default:
+			c.inline(child, parent)
+		}
+	}
+}
+
+func (c *odtConverter) table(n *xmlNode) *html.Node {
+	var t documentTable
+	var addRows func(n *xmlNode, header bool)
+	addRows = func(n *xmlNode, header bool) {
+		for _, child := range n.children {
+			switch child.name {
+			case "table-header-rows":
+				addRows(child, true)
+			case "table-rows", "table-row-group":
+				addRows(child, header)
+			case "table-row":
+				var cells []*html.Node
+				spanned := 0 // Covered cells still to skip for the last colspan
+				for _, cell := range child.children {
+					switch cell.name {
+					case "table-cell":
+						colspan, _ := strconv.Atoi(cell.attr("number-columns-spanned"))
+						rowspan, _ := strconv.Atoi(cell.attr("number-rows-spanned"))
+						spanned = max(colspan-1, 0)
+						var paragraphs []*html.Node
+						for _, p := range cell.children {
+							if p.name == "p" || p.name == "h" {
+								el := newElement("p", atom.P)
+								c.inline(p, el)
+								paragraphs = append(paragraphs, el)
+							}
+						}
+						cells = append(cells, newCell(paragraphs, colspan, rowspan))
+					case "covered-table-cell":
+						// Cells covered by a colspan are expanded by the renderer; those
+						// under a rowspan stay as empty cells to keep the columns aligned
+						if spanned > 0 {
+							spanned--
+						} else {
+							cells = append(cells, newCell(nil, 0, 0))
+						}
+					}
+				}
+				t.addRow(cells, header)
+			}
+		}
+	}
+	addRows(n, false)
+	return t.build()
+}
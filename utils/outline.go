@@ -0,0 +1,217 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+// OutlineEntry is one heading of extracted content.
+type OutlineEntry struct {
+	Level  int    `json:"level"` // 1 to 6, from h1 to h6
+	Text   string `json:"text"`
+	Anchor string `json:"anchor"` // The page's own id when it has one, else a slug of the text
+	Words  int    `json:"words"`  // Words under the heading, subsections included
+}
+
+// outlineHeading is a heading element with its level and anchor.
+type outlineHeading struct {
+	node   *html.Node
+	level  int
+	anchor string
+}
+
+// Outline lists the headings of the content in document order. A heading's section
+// runs until the next heading of the same or a higher level.
+func (e *Extraction) Outline() []OutlineEntry {
+	headings := contentHeadings(e.Node)
+	if len(headings) == 0 {
+		return nil
+	}
+
+	// Words are counted once, into the heading whose text or body they belong to
+	index := make(map[*html.Node]int, len(headings))
+	for i, h := range headings {
+		index[h.node] = i
+	}
+	titleWords := make([]int, len(headings))
+	bodyWords := make([]int, len(headings))
+	current := -1
+	var walk func(n *html.Node, heading int)
+	walk = func(n *html.Node, heading int) {
+		if i, ok := index[n]; ok {
+			heading, current = i, i
+		}
+		if n.Type == html.TextNode {
+			words := len(strings.Fields(n.Data))
+			switch {
+			case heading >= 0:
+				titleWords[heading] += words
+			case current >= 0:
+				bodyWords[current] += words
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c, heading)
+		}
+	}
+	walk(e.Node, -1)
+
+	outline := make([]OutlineEntry, len(headings))
+	for i, h := range headings {
+		words := bodyWords[i]
+		for j := i + 1; j < sectionEnd(headings, i); j++ {
+			words += titleWords[j] + bodyWords[j]
+		}
+		outline[i] = OutlineEntry{Level: h.level, Text: innerText(h.node), Anchor: h.anchor, Words: words}
+	}
+	return outline
+}
+
+// Section returns the content under the heading with the given anchor, from the heading
+// itself up to the next heading of the same or a higher level. It reports false when no
+// heading has that anchor.
+func (e *Extraction) Section(anchor string) (*Extraction, bool) {
+	copies := make(map[*html.Node]*html.Node)
+	node := cloneTree(e.Node, copies)
+
+	headings := contentHeadings(node)
+	start := -1
+	for i, h := range headings {
+		if h.anchor == anchor {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return nil, false
+	}
+
+	if end := sectionEnd(headings, start); end < len(headings) {
+		removeFrom(node, headings[end].node)
+	}
+	removeBefore(node, headings[start].node)
+
+	origins := make(map[*html.Node]*html.Node, len(copies))
+	for copied, orig := range copies {
+		if source, ok := e.origins[orig]; ok {
+			origins[copied] = source
+		}
+	}
+	return &Extraction{
+		Node:      node,
+		PageURL:   e.PageURL,
+		Title:     e.Title,
+		Author:    e.Author,
+		Published: e.Published,
+		Rule:      e.Rule,
+		origins:   origins,
+		sources:   e.sources,
+	}, true
+}
+
+// contentHeadings finds the h1-h6 elements under n and gives each a unique anchor.
+func contentHeadings(n *html.Node) []outlineHeading {
+	nodes := findAll(n, "h1", "h2", "h3", "h4", "h5", "h6")
+	headings := make([]outlineHeading, 0, len(nodes))
+	used := make(map[string]bool)
+	for _, h := range nodes {
+		if innerText(h) == "" {
+			continue
+		}
+		anchor := headingID(h)
+		if anchor == "" || used[anchor] {
+			anchor = uniqueSlug(slugify(innerText(h)), used)
+		}
+		used[anchor] = true
+		headings = append(headings, outlineHeading{node: h, level: int(h.Data[1] - '0'), anchor: anchor})
+	}
+	return headings
+}
+
+// headingID returns the id a page links to a heading by: the heading's own, that of
+// an anchor inside it, or that of a section it opens.
+func headingID(h *html.Node) string {
+	if id := getAttr(h, "id"); id != "" {
+		return id
+	}
+	for _, a := range findAll(h, "a") {
+		if id := getAttr(a, "id"); id != "" {
+			return id
+		}
+		if name := getAttr(a, "name"); name != "" {
+			return name
+		}
+	}
+	if parent := h.Parent; parent != nil && parent.Type == html.ElementNode && parent.Data == "section" {
+		first := parent.FirstChild
+		for first != nil && first.Type != html.ElementNode {
+			first = first.NextSibling
+		}
+		if first == h {
+			return getAttr(parent, "id")
+		}
+	}
+	return ""
+}
+
+// slugify turns heading text into an anchor the way GitHub does: lower case, spaces
+// as dashes, and punctuation other than dashes and underscores dropped.
+func slugify(text string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r), r == '-', r == '_':
+			b.WriteRune(r)
+		case unicode.IsSpace(r):
+			b.WriteRune('-')
+		}
+	}
+	if b.Len() == 0 {
+		return "section"
+	}
+	return b.String()
+}
+
+// uniqueSlug numbers slug as GitHub does when the anchor is already taken.
+func uniqueSlug(slug string, used map[string]bool) string {
+	candidate := slug
+	for i := 1; used[candidate]; i++ {
+		candidate = fmt.Sprintf("%s-%d", slug, i)
+	}
+	return candidate
+}
+
+// sectionEnd returns the index of the heading that ends heading i's section, or
+// len(headings) when the section runs to the end of the content.
+func sectionEnd(headings []outlineHeading, i int) int {
+	for j := i + 1; j < len(headings); j++ {
+		if headings[j].level <= headings[i].level {
+			return j
+		}
+	}
+	return len(headings)
+}
+
+// removeBefore removes everything under root that comes before n in document order,
+// keeping n's ancestors.
+func removeBefore(root, n *html.Node) {
+	for ; n != root && n.Parent != nil; n = n.Parent {
+		for prev := n.PrevSibling; prev != nil; prev = n.PrevSibling {
+			n.Parent.RemoveChild(prev)
+		}
+	}
+}
+
+// removeFrom removes n and everything under root that follows it in document order,
+// keeping n's ancestors.
+func removeFrom(root, n *html.Node) {
+	for c := n; c != root && c.Parent != nil; c = c.Parent {
+		for next := c.NextSibling; next != nil; next = c.NextSibling {
+			c.Parent.RemoveChild(next)
+		}
+	}
+	n.Parent.RemoveChild(n)
+}
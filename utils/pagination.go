@@ -0,0 +1,217 @@
+package utils
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var (
+	rePaginationContainer = regexp.MustCompile(`(?i)pagination|pager|paging|page-?nav|page-?numbers|nav-?links|wp-pagenavi`)
+	rePaginationURL       = regexp.MustCompile(`(?i)page|[?&](p|pg|start|offset)=|/p/?\d+|/\d+/?$`)
+	reNextClass           = regexp.MustCompile(`(?i)(^|[-_ ])next([-_ ]|$)`)
+	reCurrentClass        = regexp.MustCompile(`(?i)(^|\s)(current|active|selected)(\s|$)`)
+)
+
+// Anchor texts that mean "next page" once arrows and whitespace are trimmed
+var nextPageTexts = map[string]bool{
+	"next": true, "next page": true, "older posts": true, "older entries": true,
+	"nächste": true, "weiter": true, "suivant": true, "siguiente": true, "successivo": true, "próxima": true,
+}
+
+// FindNextPage returns the URL of the page following pageURL, or "" if doc doesn't look paginated.
+// It tries <link rel=next>, then rel=next anchors, then "next" anchors, then the number after
+// the current one in a numbered pager. Only http(s) links on the same site count.
+func FindNextPage(doc *html.Node, pageURL string) string {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return ""
+	}
+	current := *base
+	current.Fragment = ""
+	resolve := func(href string) string {
+		href = strings.TrimSpace(href)
+		if href == "" || strings.HasPrefix(href, "#") {
+			return ""
+		}
+		u, err := url.Parse(href)
+		if err != nil {
+			return ""
+		}
+		u = base.ResolveReference(u)
+		u.Fragment = ""
+		if u.Scheme != "http" && u.Scheme != "https" || !sameSite(u.Hostname(), base.Hostname()) {
+			return ""
+		}
+		if u.String() == current.String() {
+			return ""
+		}
+		return u.String()
+	}
+
+	for _, link := range findAll(doc, "link") {
+		if hasRel(link, "next") {
+			if next := resolve(getAttr(link, "href")); next != "" {
+				return next
+			}
+		}
+	}
+
+	anchors := findAll(doc, "a")
+	for _, a := range anchors {
+		if hasRel(a, "next") {
+			if next := resolve(getAttr(a, "href")); next != "" {
+				return next
+			}
+		}
+	}
+
+	for _, a := range anchors {
+		text := strings.ToLower(strings.Trim(innerText(a), " ›»→>·."))
+		if text == "" {
+			text = strings.ToLower(strings.TrimSpace(getAttr(a, "aria-label")))
+		}
+		inPager := inPaginationContainer(a)
+		named := nextPageTexts[text] || text == "" && inPager && reNextClass.MatchString(getAttr(a, "class"))
+		if !named {
+			continue
+		}
+		next := resolve(getAttr(a, "href"))
+		if next == "" {
+			continue
+		}
+		// A bare "next" could be the next article; require a pager or a paging URL
+		if text == "next page" || inPager || rePaginationURL.MatchString(next) {
+			return next
+		}
+	}
+
+	return numberedNextPage(anchors, resolve)
+}
+
+// numberedNextPage finds the current page in a numbered pager and returns the link to the one after it.
+func numberedNextPage(anchors []*html.Node, resolve func(string) string) string {
+	for _, pager := range pagerContainers(anchors) {
+		current := 0
+		for _, n := range append([]*html.Node{pager}, allElements(pager)...) {
+			if getAttr(n, "aria-current") != "page" && !reCurrentClass.MatchString(getAttr(n, "class")) {
+				continue
+			}
+			if num, err := strconv.Atoi(innerText(n)); err == nil {
+				current = num
+				break
+			}
+		}
+		if current == 0 {
+			continue
+		}
+		for _, a := range findAll(pager, "a") {
+			if innerText(a) == strconv.Itoa(current+1) {
+				if next := resolve(getAttr(a, "href")); next != "" {
+					return next
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// pagerContainers returns the distinct pagination containers holding any of anchors.
+func pagerContainers(anchors []*html.Node) []*html.Node {
+	var pagers []*html.Node
+	seen := make(map[*html.Node]bool)
+	for _, a := range anchors {
+		for p := a.Parent; p != nil && p.Type == html.ElementNode; p = p.Parent {
+			if rePaginationContainer.MatchString(getAttr(p, "class") + " " + getAttr(p, "id") + " " + getAttr(p, "aria-label")) {
+				if !seen[p] {
+					seen[p] = true
+					pagers = append(pagers, p)
+				}
+				break
+			}
+		}
+	}
+	return pagers
+}
+
+func inPaginationContainer(n *html.Node) bool {
+	return len(pagerContainers([]*html.Node{n})) > 0
+}
+
+func allElements(n *html.Node) []*html.Node {
+	var found []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode {
+			found = append(found, c)
+			found = append(found, allElements(c)...)
+		}
+	}
+	return found
+}
+
+func hasRel(n *html.Node, rel string) bool {
+	for _, r := range strings.Fields(strings.ToLower(getAttr(n, "rel"))) {
+		if r == rel {
+			return true
+		}
+	}
+	return false
+}
+
+// sameSite compares hosts, ignoring a leading "www."
+func sameSite(a, b string) bool {
+	return strings.TrimPrefix(strings.ToLower(a), "www.") == strings.TrimPrefix(strings.ToLower(b), "www.")
+}
+
+// Append adds the content of a following page to e. Headings and short blocks
+// already seen on earlier pages (the repeated title, byline or share prompt)
+// are dropped from next before it is appended.
+func (e *Extraction) Append(next *Extraction) {
+	seen := make(map[string]bool)
+	for _, n := range repeatableBlocks(e.Node) {
+		seen[strings.ToLower(innerText(n))] = true
+	}
+
+	for _, n := range repeatableBlocks(next.Node) {
+		if seen[strings.ToLower(innerText(n))] && n.Parent != nil {
+			n.Parent.RemoveChild(n)
+		}
+	}
+
+	for c := next.Node.FirstChild; c != nil; {
+		following := c.NextSibling
+		next.Node.RemoveChild(c)
+		e.Node.AppendChild(c)
+		c = following
+	}
+
+	for copied, orig := range next.origins {
+		if e.origins == nil {
+			e.origins = make(map[*html.Node]*html.Node)
+		}
+		e.origins[copied] = orig
+	}
+	if e.matches != nil {
+		e.matches = append(e.matches, next.matches...)
+	}
+	e.sources = append(e.sources, next.sources...)
+}
+
+// repeatableBlocks returns headings and short leaf blocks under n: the parts of a
+// page that tend to repeat on every page of a paginated article.
+func repeatableBlocks(n *html.Node) []*html.Node {
+	var blocks []*html.Node
+	for _, el := range findAll(n, "h1", "h2", "h3", "h4", "h5", "h6", "p", "div", "span", "time", "figcaption") {
+		text := innerText(el)
+		if text == "" || hasChildBlockElement(el) {
+			continue
+		}
+		if len(el.Data) == 2 && el.Data[0] == 'h' || len(text) < 120 {
+			blocks = append(blocks, el)
+		}
+	}
+	return blocks
+}
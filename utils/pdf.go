@@ -0,0 +1,1043 @@
+package utils
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf16"
+)
+
+// PDF errors callers may want to tell apart
+var (
+	ErrPDFEncrypted = errors.New("encrypted PDFs are not supported")
+	ErrPDFMalformed = errors.New("malformed PDF")
+)
+
+// Limits that keep a hostile PDF from exhausting memory or time
+const (
+	pdfMaxStreamSize = 64 << 20 // Decoded bytes per stream
+	pdfMaxDepth      = 32       // Nesting of page trees, forms and objects
+)
+
+// PDF object model. Numbers are float64, booleans bool and null nil.
+type (
+	pdfName    string
+	pdfString  string // Raw bytes of a literal or hex string
+	pdfKeyword string // Bare words: operators, obj, stream, R, and delimiters like [ and <<
+	pdfArray   []interface{}
+	pdfDict    map[pdfName]interface{}
+	pdfRef     struct{ num, gen int }
+	pdfStream  struct {
+		dict pdfDict
+		raw  []byte
+	}
+)
+
+// pdfLexer reads tokens and objects from PDF syntax.
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func isPDFSpace(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+func isPDFDelimiter(c byte) bool {
+	return bytes.IndexByte([]byte("()<>[]{}/%"), c) >= 0
+}
+
+// skipSpace skips whitespace and comments.
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		if !isPDFSpace(c) {
+			return
+		}
+		l.pos++
+	}
+}
+
+// token returns the next token, or io.EOF.
+func (l *pdfLexer) token() (interface{}, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, io.EOF
+	}
+
+	c := l.data[l.pos]
+	switch c {
+	case '[', ']', '{', '}':
+		l.pos++
+		return pdfKeyword(c), nil
+	case '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return pdfKeyword("<<"), nil
+		}
+		return l.hexString()
+	case '>':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '>' {
+			l.pos += 2
+			return pdfKeyword(">>"), nil
+		}
+		l.pos++
+		return nil, fmt.Errorf("%w: stray '>'", ErrPDFMalformed)
+	case '(':
+		return l.literalString()
+	case '/':
+		return l.name(), nil
+	case ')':
+		l.pos++
+		return nil, fmt.Errorf("%w: stray ')'", ErrPDFMalformed)
+	}
+
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	word := string(l.data[start:l.pos])
+	if c == '+' || c == '-' || c == '.' || c >= '0' && c <= '9' {
+		if f, err := strconv.ParseFloat(word, 64); err == nil {
+			return f, nil
+		}
+	}
+	return pdfKeyword(word), nil
+}
+
+func (l *pdfLexer) name() pdfName {
+	l.pos++ // '/'
+	var buf []byte
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		c := l.data[l.pos]
+		if c == '#' && l.pos+2 < len(l.data) {
+			if b, err := hex.DecodeString(string(l.data[l.pos+1 : l.pos+3])); err == nil {
+				buf = append(buf, b[0])
+				l.pos += 3
+				continue
+			}
+		}
+		buf = append(buf, c)
+		l.pos++
+	}
+	return pdfName(buf)
+}
+
+func (l *pdfLexer) hexString() (interface{}, error) {
+	l.pos++ // '<'
+	var digits []byte
+	for l.pos < len(l.data) && l.data[l.pos] != '>' {
+		if c := l.data[l.pos]; !isPDFSpace(c) {
+			digits = append(digits, c)
+		}
+		l.pos++
+	}
+	l.pos++ // '>'
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	b, err := hex.DecodeString(string(digits))
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad hex string", ErrPDFMalformed)
+	}
+	return pdfString(b), nil
+}
+
+func (l *pdfLexer) literalString() (interface{}, error) {
+	l.pos++ // '('
+	var buf []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return pdfString(buf), nil
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				continue
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue // Line continuation
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		buf = append(buf, c)
+	}
+	return nil, fmt.Errorf("%w: unterminated string", ErrPDFMalformed)
+}
+
+// object parses one object, turning "n g R" into a reference. Keywords other than
+// true, false and null come back as pdfKeyword (operators in content streams).
+func (l *pdfLexer) object(depth int) (interface{}, error) {
+	if depth > pdfMaxDepth {
+		return nil, fmt.Errorf("%w: nesting too deep", ErrPDFMalformed)
+	}
+	tok, err := l.token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := tok.(type) {
+	case float64:
+		if t != float64(int(t)) || t < 0 {
+			return t, nil
+		}
+		save := l.pos
+		if gen, err := l.token(); err == nil {
+			if g, ok := gen.(float64); ok && g == float64(int(g)) {
+				if r, err := l.token(); err == nil && r == pdfKeyword("R") {
+					return pdfRef{int(t), int(g)}, nil
+				}
+			}
+		}
+		l.pos = save
+		return t, nil
+	case pdfKeyword:
+		switch t {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		case "[":
+			var arr pdfArray
+			for {
+				l.skipSpace()
+				if l.pos < len(l.data) && l.data[l.pos] == ']' {
+					l.pos++
+					return arr, nil
+				}
+				item, err := l.object(depth + 1)
+				if err != nil {
+					return nil, err
+				}
+				arr = append(arr, item)
+			}
+		case "<<":
+			dict := make(pdfDict)
+			for {
+				key, err := l.token()
+				if err != nil {
+					return nil, err
+				}
+				if key == pdfKeyword(">>") {
+					return dict, nil
+				}
+				name, ok := key.(pdfName)
+				if !ok {
+					return nil, fmt.Errorf("%w: dictionary key is not a name", ErrPDFMalformed)
+				}
+				value, err := l.object(depth + 1)
+				if err != nil {
+					return nil, err
+				}
+				if value == pdfKeyword(">>") {
+					return dict, nil // Key without a value
+				}
+				dict[name] = value
+			}
+		}
+	}
+	return tok, nil
+}
+
+// pdfXrefEntry locates an object: at an offset, or inside an object stream.
+type pdfXrefEntry struct {
+	offset int
+	stream int // Object stream number when compressed
+	index  int
+	inUse  bool
+	inObjS bool
+}
+
+// pdfDocument is a parsed PDF file. Objects are loaded on demand.
+type pdfDocument struct {
+	data    []byte
+	xref    map[int]pdfXrefEntry
+	trailer pdfDict
+	cache   map[int]interface{}
+	loading map[int]bool
+	objStms map[int]*pdfObjectStream
+	rebuilt bool // The xref was damaged and rebuilt by scanning the file
+}
+
+type pdfObjectStream struct {
+	data    []byte
+	offsets map[int]int // Object number -> offset in data
+}
+
+// openPDF parses the cross-reference data of a PDF, rebuilding it by scanning
+// the file when it is missing or damaged.
+func openPDF(data []byte) (*pdfDocument, error) {
+	// The header may follow a little junk, but must be near the start
+	if !bytes.Contains(data[:min(len(data), 1024)], []byte("%PDF-")) {
+		return nil, fmt.Errorf("%w: missing %%PDF header", ErrPDFMalformed)
+	}
+	doc := &pdfDocument{
+		data:    data,
+		xref:    make(map[int]pdfXrefEntry),
+		trailer: make(pdfDict),
+		cache:   make(map[int]interface{}),
+		loading: make(map[int]bool),
+		objStms: make(map[int]*pdfObjectStream),
+	}
+
+	if err := doc.readXref(); err != nil || doc.trailer["Root"] == nil {
+		doc.xref = make(map[int]pdfXrefEntry)
+		doc.trailer = make(pdfDict)
+		doc.cache = make(map[int]interface{})
+		if err := doc.rebuildXref(); err != nil {
+			return nil, err
+		}
+		doc.rebuilt = true
+	}
+	if doc.trailer["Encrypt"] != nil {
+		return nil, ErrPDFEncrypted
+	}
+	return doc, nil
+}
+
+// readXref follows startxref and the /Prev chain through xref tables and streams.
+func (d *pdfDocument) readXref() error {
+	idx := bytes.LastIndex(d.data, []byte("startxref"))
+	if idx < 0 {
+		return fmt.Errorf("%w: no startxref", ErrPDFMalformed)
+	}
+	l := &pdfLexer{data: d.data, pos: idx + len("startxref")}
+	tok, err := l.token()
+	offset, ok := tok.(float64)
+	if err != nil || !ok {
+		return fmt.Errorf("%w: bad startxref", ErrPDFMalformed)
+	}
+
+	visited := make(map[int]bool)
+	pending := []int{int(offset)}
+	for len(pending) > 0 {
+		off := pending[0]
+		pending = pending[1:]
+		if off <= 0 || off >= len(d.data) || visited[off] {
+			continue
+		}
+		visited[off] = true
+
+		var trailer pdfDict
+		l := &pdfLexer{data: d.data, pos: off}
+		l.skipSpace()
+		if bytes.HasPrefix(d.data[l.pos:], []byte("xref")) {
+			l.pos += 4
+			if trailer, err = d.readXrefTable(l); err != nil {
+				return err
+			}
+		} else if trailer, err = d.readXrefStream(l); err != nil {
+			return err
+		}
+
+		for k, v := range trailer {
+			if _, ok := d.trailer[k]; !ok {
+				d.trailer[k] = v
+			}
+		}
+		// Hybrid files keep their compressed objects in a separate xref stream
+		if stm, ok := trailer["XRefStm"].(float64); ok {
+			pending = append(pending, int(stm))
+		}
+		if prev, ok := trailer["Prev"].(float64); ok {
+			pending = append(pending, int(prev))
+		}
+	}
+	return nil
+}
+
+// setXref records an entry unless a newer section already defined the object.
+func (d *pdfDocument) setXref(num int, entry pdfXrefEntry) {
+	if _, ok := d.xref[num]; !ok {
+		d.xref[num] = entry
+	}
+}
+
+func (d *pdfDocument) readXrefTable(l *pdfLexer) (pdfDict, error) {
+	for {
+		tok, err := l.token()
+		if err != nil {
+			return nil, fmt.Errorf("%w: truncated xref table", ErrPDFMalformed)
+		}
+		if tok == pdfKeyword("trailer") {
+			obj, err := l.object(0)
+			if err != nil {
+				return nil, err
+			}
+			trailer, ok := obj.(pdfDict)
+			if !ok {
+				return nil, fmt.Errorf("%w: bad trailer", ErrPDFMalformed)
+			}
+			return trailer, nil
+		}
+
+		start, ok1 := tok.(float64)
+		countTok, _ := l.token()
+		count, ok2 := countTok.(float64)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("%w: bad xref subsection", ErrPDFMalformed)
+		}
+		for i := 0; i < int(count); i++ {
+			offTok, _ := l.token()
+			_, _ = l.token() // Generation
+			kind, _ := l.token()
+			off, ok := offTok.(float64)
+			if !ok || (kind != pdfKeyword("n") && kind != pdfKeyword("f")) {
+				return nil, fmt.Errorf("%w: bad xref entry", ErrPDFMalformed)
+			}
+			d.setXref(int(start)+i, pdfXrefEntry{offset: int(off), inUse: kind == pdfKeyword("n")})
+		}
+	}
+}
+
+func (d *pdfDocument) readXrefStream(l *pdfLexer) (pdfDict, error) {
+	_, obj, err := d.indirectObject(l)
+	if err != nil {
+		return nil, err
+	}
+	stream, ok := obj.(*pdfStream)
+	if !ok || stream.dict["Type"] != pdfName("XRef") {
+		return nil, fmt.Errorf("%w: startxref points at neither a table nor a stream", ErrPDFMalformed)
+	}
+	data, err := d.decodeStream(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	w, _ := stream.dict["W"].(pdfArray)
+	if len(w) < 3 {
+		return nil, fmt.Errorf("%w: bad xref stream /W", ErrPDFMalformed)
+	}
+	widths := make([]int, 3)
+	rowLen := 0
+	for i := range widths {
+		f, _ := w[i].(float64)
+		widths[i] = int(f)
+		rowLen += widths[i]
+	}
+	if rowLen == 0 {
+		return nil, fmt.Errorf("%w: bad xref stream /W", ErrPDFMalformed)
+	}
+
+	size, _ := stream.dict["Size"].(float64)
+	index, _ := stream.dict["Index"].(pdfArray)
+	if len(index) == 0 {
+		index = pdfArray{0.0, size}
+	}
+
+	pos := 0
+	field := func(width int, def int) int {
+		if width == 0 {
+			return def
+		}
+		v := 0
+		for i := 0; i < width; i++ {
+			v = v<<8 | int(data[pos])
+			pos++
+		}
+		return v
+	}
+	for i := 0; i+1 < len(index); i += 2 {
+		start, _ := index[i].(float64)
+		count, _ := index[i+1].(float64)
+		for n := 0; n < int(count) && pos+rowLen <= len(data); n++ {
+			kind := field(widths[0], 1)
+			a := field(widths[1], 0)
+			b := field(widths[2], 0)
+			switch kind {
+			case 0:
+				d.setXref(int(start)+n, pdfXrefEntry{})
+			case 1:
+				d.setXref(int(start)+n, pdfXrefEntry{offset: a, inUse: true})
+			case 2:
+				d.setXref(int(start)+n, pdfXrefEntry{stream: a, index: b, inUse: true, inObjS: true})
+			}
+		}
+	}
+	return stream.dict, nil
+}
+
+var rePDFObjectHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+// rebuildXref finds every "n g obj" in the file, and the objects packed in object
+// streams, for files whose cross-references are missing or broken.
+func (d *pdfDocument) rebuildXref() error {
+	for _, m := range rePDFObjectHeader.FindAllSubmatchIndex(d.data, -1) {
+		num, _ := strconv.Atoi(string(d.data[m[2]:m[3]]))
+		d.xref[num] = pdfXrefEntry{offset: m[0], inUse: true} // Later definitions win
+	}
+	if len(d.xref) == 0 {
+		return fmt.Errorf("%w: no objects found", ErrPDFMalformed)
+	}
+
+	nums := make([]int, 0, len(d.xref))
+	for num := range d.xref {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	for _, num := range nums {
+		if stream, ok := d.get(num).(*pdfStream); ok && stream.dict["Type"] == pdfName("ObjStm") {
+			if objStm := d.loadObjectStream(num); objStm != nil {
+				d.objStms[num] = objStm
+				for packed := range objStm.offsets {
+					d.setXref(packed, pdfXrefEntry{stream: num, inUse: true, inObjS: true})
+				}
+			}
+		}
+	}
+
+	// Prefer the last classic trailer, then an xref stream's dictionary, then a bare catalog
+	if idx := bytes.LastIndex(d.data, []byte("trailer")); idx >= 0 {
+		l := &pdfLexer{data: d.data, pos: idx + len("trailer")}
+		if trailer, ok := objectOrNil(l).(pdfDict); ok {
+			d.trailer = trailer
+		}
+	}
+	for _, num := range nums {
+		if d.trailer["Root"] != nil {
+			break
+		}
+		if stream, ok := d.get(num).(*pdfStream); ok && stream.dict["Type"] == pdfName("XRef") && stream.dict["Root"] != nil {
+			d.trailer = stream.dict
+		}
+	}
+	if d.trailer["Root"] == nil {
+		for _, num := range nums {
+			if dict, ok := d.get(num).(pdfDict); ok && dict["Type"] == pdfName("Catalog") {
+				d.trailer["Root"] = pdfRef{num, 0}
+				break
+			}
+		}
+	}
+	if d.trailer["Root"] == nil {
+		return fmt.Errorf("%w: no document catalog", ErrPDFMalformed)
+	}
+	return nil
+}
+
+// objectOrNil parses the next object, returning nil on error.
+func objectOrNil(l *pdfLexer) interface{} {
+	obj, err := l.object(0)
+	if err != nil {
+		return nil
+	}
+	return obj
+}
+
+// indirectObject parses "n g obj ... endobj" at the lexer position, including a stream body.
+func (d *pdfDocument) indirectObject(l *pdfLexer) (int, interface{}, error) {
+	numTok, _ := l.token()
+	_, _ = l.token()
+	objTok, _ := l.token()
+	num, ok := numTok.(float64)
+	if !ok || objTok != pdfKeyword("obj") {
+		return 0, nil, fmt.Errorf("%w: expected object header", ErrPDFMalformed)
+	}
+	obj, err := l.object(0)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	dict, isDict := obj.(pdfDict)
+	save := l.pos
+	if tok, err := l.token(); !isDict || err != nil || tok != pdfKeyword("stream") {
+		l.pos = save
+		return int(num), obj, nil
+	}
+
+	// The stream body starts after the EOL that follows the keyword
+	if l.pos < len(d.data) && d.data[l.pos] == '\r' {
+		l.pos++
+	}
+	if l.pos < len(d.data) && d.data[l.pos] == '\n' {
+		l.pos++
+	}
+	start := l.pos
+
+	end := -1
+	if length, ok := d.resolve(dict["Length"]).(float64); ok && length >= 0 && start+int(length) <= len(d.data) {
+		candidate := start + int(length)
+		rest := bytes.TrimLeft(d.data[candidate:min(len(d.data), candidate+32)], "\x00\t\n\r ")
+		if bytes.HasPrefix(rest, []byte("endstream")) {
+			end = candidate
+		}
+	}
+	if end < 0 {
+		// Missing or wrong /Length: trust the endstream keyword instead
+		idx := bytes.Index(d.data[start:], []byte("endstream"))
+		if idx < 0 {
+			return 0, nil, fmt.Errorf("%w: unterminated stream", ErrPDFMalformed)
+		}
+		end = start + idx
+		for end > start && (d.data[end-1] == '\n' || d.data[end-1] == '\r') {
+			end--
+		}
+	}
+	return int(num), &pdfStream{dict: dict, raw: d.data[start:end]}, nil
+}
+
+// get loads object num, returning nil when it is missing or broken.
+func (d *pdfDocument) get(num int) interface{} {
+	if obj, ok := d.cache[num]; ok {
+		return obj
+	}
+	entry, ok := d.xref[num]
+	if !ok || !entry.inUse || d.loading[num] {
+		return nil
+	}
+	d.loading[num] = true
+	defer delete(d.loading, num)
+
+	var obj interface{}
+	if entry.inObjS {
+		obj = d.getCompressed(num, entry)
+	} else if entry.offset > 0 && entry.offset < len(d.data) {
+		if _, parsed, err := d.indirectObject(&pdfLexer{data: d.data, pos: entry.offset}); err == nil {
+			obj = parsed
+		}
+	}
+	d.cache[num] = obj
+	return obj
+}
+
+func (d *pdfDocument) getCompressed(num int, entry pdfXrefEntry) interface{} {
+	objStm, ok := d.objStms[entry.stream]
+	if !ok {
+		objStm = d.loadObjectStream(entry.stream)
+		d.objStms[entry.stream] = objStm
+	}
+	if objStm == nil {
+		return nil
+	}
+	offset, ok := objStm.offsets[num]
+	if !ok || offset >= len(objStm.data) {
+		return nil
+	}
+	obj, err := (&pdfLexer{data: objStm.data, pos: offset}).object(0)
+	if err != nil {
+		return nil
+	}
+	return obj
+}
+
+func (d *pdfDocument) loadObjectStream(num int) *pdfObjectStream {
+	stream, ok := d.get(num).(*pdfStream)
+	if !ok {
+		return nil
+	}
+	data, err := d.decodeStream(stream)
+	if err != nil {
+		return nil
+	}
+	n, _ := stream.dict["N"].(float64)
+	first, _ := stream.dict["First"].(float64)
+
+	objStm := &pdfObjectStream{data: data, offsets: make(map[int]int)}
+	l := &pdfLexer{data: data}
+	for i := 0; i < int(n); i++ {
+		numTok, _ := l.token()
+		offTok, _ := l.token()
+		objNum, ok1 := numTok.(float64)
+		off, ok2 := offTok.(float64)
+		if !ok1 || !ok2 {
+			break
+		}
+		objStm.offsets[int(objNum)] = int(first) + int(off)
+	}
+	return objStm
+}
+
+// resolve follows references until it reaches a direct object.
+func (d *pdfDocument) resolve(obj interface{}) interface{} {
+	for i := 0; i < pdfMaxDepth; i++ {
+		ref, ok := obj.(pdfRef)
+		if !ok {
+			return obj
+		}
+		obj = d.get(ref.num)
+	}
+	return nil
+}
+
+func (d *pdfDocument) dict(obj interface{}) pdfDict {
+	switch v := d.resolve(obj).(type) {
+	case pdfDict:
+		return v
+	case *pdfStream:
+		return v.dict
+	}
+	return nil
+}
+
+func (d *pdfDocument) array(obj interface{}) pdfArray {
+	arr, _ := d.resolve(obj).(pdfArray)
+	return arr
+}
+
+func (d *pdfDocument) number(obj interface{}) (float64, bool) {
+	f, ok := d.resolve(obj).(float64)
+	return f, ok
+}
+
+// decodeStream applies the stream's filters.
+func (d *pdfDocument) decodeStream(s *pdfStream) ([]byte, error) {
+	var filters pdfArray
+	switch f := d.resolve(s.dict["Filter"]).(type) {
+	case pdfName:
+		filters = pdfArray{f}
+	case pdfArray:
+		filters = f
+	}
+	var params pdfArray
+	switch p := d.resolve(s.dict["DecodeParms"]).(type) {
+	case pdfDict:
+		params = pdfArray{p}
+	case pdfArray:
+		params = p
+	}
+
+	data := s.raw
+	for i, f := range filters {
+		var param pdfDict
+		if i < len(params) {
+			param = d.dict(params[i])
+		}
+		var err error
+		name, _ := d.resolve(f).(pdfName)
+		switch name {
+		case "FlateDecode", "Fl":
+			data, err = flateDecode(data)
+			if err == nil {
+				data = d.applyPredictor(data, param)
+			}
+		case "LZWDecode", "LZW":
+			early := 1
+			if v, ok := d.number(param["EarlyChange"]); ok {
+				early = int(v)
+			}
+			data = d.applyPredictor(lzwDecode(data, early), param)
+		case "ASCIIHexDecode", "AHx":
+			data, err = asciiHexDecode(data)
+		case "ASCII85Decode", "A85":
+			data, err = ascii85Decode(data)
+		case "RunLengthDecode", "RL":
+			data = runLengthDecode(data)
+		case "Crypt":
+			// Identity crypt filter
+		default:
+			return nil, fmt.Errorf("unsupported PDF filter %s", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// flateDecode inflates zlib data, tolerating truncated streams and missing zlib headers.
+func flateDecode(data []byte) ([]byte, error) {
+	var r io.Reader
+	if zr, err := zlib.NewReader(bytes.NewReader(data)); err == nil {
+		r = zr
+	} else {
+		r = flate.NewReader(bytes.NewReader(data))
+	}
+	out, err := io.ReadAll(io.LimitReader(r, pdfMaxStreamSize))
+	if err != nil && len(out) == 0 {
+		return nil, fmt.Errorf("%w: %v", ErrPDFMalformed, err)
+	}
+	return out, nil
+}
+
+// applyPredictor undoes PNG row prediction (Predictor >= 10), used mostly by xref streams.
+func (d *pdfDocument) applyPredictor(data []byte, params pdfDict) []byte {
+	predictor, _ := d.number(params["Predictor"])
+	if predictor < 10 {
+		return data
+	}
+	colors, bpc, columns := 1.0, 8.0, 1.0
+	if v, ok := d.number(params["Colors"]); ok {
+		colors = v
+	}
+	if v, ok := d.number(params["BitsPerComponent"]); ok {
+		bpc = v
+	}
+	if v, ok := d.number(params["Columns"]); ok {
+		columns = v
+	}
+	bpp := max(1, int(colors*bpc+7)/8)
+	rowLen := int(colors*bpc*columns+7) / 8
+	if rowLen <= 0 {
+		return data
+	}
+
+	var out []byte
+	prev := make([]byte, rowLen)
+	for pos := 0; pos+1+rowLen <= len(data); pos += 1 + rowLen {
+		kind := data[pos]
+		row := append([]byte(nil), data[pos+1:pos+1+rowLen]...)
+		for i := range row {
+			var left, upLeft byte
+			if i >= bpp {
+				left, upLeft = row[i-bpp], prev[i-bpp]
+			}
+			up := prev[i]
+			switch kind {
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			}
+		}
+		out = append(out, row...)
+		prev = row
+	}
+	return out
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	}
+	return c
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// lzwDecode decodes PDF LZW data (MSB-first codes of 9 to 12 bits).
+func lzwDecode(data []byte, earlyChange int) []byte {
+	var out []byte
+	table := make([][]byte, 258, 4096)
+	reset := func() {
+		table = table[:258]
+		for i := 0; i < 256; i++ {
+			table[i] = []byte{byte(i)}
+		}
+	}
+	reset()
+
+	codeLen := 9
+	var prev []byte
+	var buf uint32
+	bits := 0
+	for pos := 0; ; {
+		for bits < codeLen {
+			if pos >= len(data) {
+				return out
+			}
+			buf = buf<<8 | uint32(data[pos])
+			pos++
+			bits += 8
+		}
+		code := int(buf>>(bits-codeLen)) & (1<<codeLen - 1)
+		bits -= codeLen
+
+		switch {
+		case code == 256:
+			reset()
+			codeLen, prev = 9, nil
+			continue
+		case code == 257:
+			return out
+		}
+
+		var entry []byte
+		switch {
+		case code < len(table) && table[code] != nil:
+			entry = table[code]
+		case code == len(table) && prev != nil:
+			entry = append(append([]byte(nil), prev...), prev[0])
+		default:
+			return out
+		}
+		out = append(out, entry...)
+		if len(out) > pdfMaxStreamSize {
+			return out
+		}
+		if prev != nil && len(table) < 4096 {
+			table = append(table, append(append([]byte(nil), prev...), entry[0]))
+		}
+		prev = entry
+		if len(table)+earlyChange >= 1<<codeLen && codeLen < 12 {
+			codeLen++
+		}
+	}
+}
+
+func asciiHexDecode(data []byte) ([]byte, error) {
+	var digits []byte
+	for _, c := range data {
+		if c == '>' {
+			break
+		}
+		if !isPDFSpace(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out, err := hex.DecodeString(string(digits))
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad ASCIIHex data", ErrPDFMalformed)
+	}
+	return out, nil
+}
+
+func ascii85Decode(data []byte) ([]byte, error) {
+	data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("<~"))
+	if end := bytes.Index(data, []byte("~>")); end >= 0 {
+		data = data[:end]
+	}
+	out := make([]byte, len(data))
+	n, _, err := ascii85.Decode(out, data, true)
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad ASCII85 data", ErrPDFMalformed)
+	}
+	return out[:n], nil
+}
+
+func runLengthDecode(data []byte) []byte {
+	var out []byte
+	for i := 0; i < len(data); {
+		n := int(data[i])
+		i++
+		switch {
+		case n < 128:
+			end := min(i+n+1, len(data))
+			out = append(out, data[i:end]...)
+			i = end
+		case n > 128:
+			if i < len(data) {
+				out = append(out, bytes.Repeat(data[i:i+1], 257-n)...)
+				i++
+			}
+		default:
+			return out // 128 is EOD
+		}
+	}
+	return out
+}
+
+// pdfTextString decodes a PDF text string: UTF-16BE or UTF-8 with a BOM, else PDFDocEncoding.
+func pdfTextString(s pdfString) string {
+	b := []byte(s)
+	switch {
+	case len(b) >= 2 && b[0] == 0xFE && b[1] == 0xFF:
+		return decodeUTF16BE(b[2:])
+	case len(b) >= 3 && b[0] == 0xEF && b[1] == 0xBB && b[2] == 0xBF:
+		return string(b[3:])
+	}
+	runes := make([]rune, 0, len(b))
+	for _, c := range b {
+		runes = append(runes, pdfDocEncoding(c))
+	}
+	return string(runes)
+}
+
+func decodeUTF16BE(b []byte) string {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
+
+// pdfDocEncoding maps a PDFDocEncoding byte; it matches WinAnsi for the printable range.
+func pdfDocEncoding(c byte) rune {
+	if r := winAnsiEncoding[c]; r != 0 {
+		return r
+	}
+	return rune(c)
+}
+
+var rePDFDate = regexp.MustCompile(`^D?:?(\d{4})(\d{2})?(\d{2})?(\d{2})?(\d{2})?(\d{2})?([Zz+\-])?(\d{2})?'?(\d{2})?'?`)
+
+// parsePDFDate turns "D:20230115123045+01'00'" into RFC 3339, or returns s unchanged.
+func parsePDFDate(s string) string {
+	m := rePDFDate.FindStringSubmatch(s)
+	if m == nil {
+		return s
+	}
+	num := func(v string, def int) int {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+		return def
+	}
+	loc := time.UTC
+	if m[7] == "+" || m[7] == "-" {
+		offset := num(m[8], 0)*3600 + num(m[9], 0)*60
+		if m[7] == "-" {
+			offset = -offset
+		}
+		loc = time.FixedZone("", offset)
+	}
+	t := time.Date(num(m[1], 0), time.Month(num(m[2], 1)), num(m[3], 1), num(m[4], 0), num(m[5], 0), num(m[6], 0), 0, loc)
+	return t.Format(time.RFC3339)
+}
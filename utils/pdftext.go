@@ -0,0 +1,773 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ExtractPDF extracts the text of the pages of a PDF in pages, with the document's
+// title, author and dates. Encrypted files return ErrPDFEncrypted and unreadable ones
+// an error wrapping ErrPDFMalformed.
+func ExtractPDF(data []byte, pages PageRange) (info *DocumentInfo, err error) {
+	// Hostile files can still trip an index somewhere; never take the service down for one
+	defer func() {
+		if r := recover(); r != nil {
+			info, err = nil, fmt.Errorf("%w: %v", ErrPDFMalformed, r)
+		}
+	}()
+
+	doc, err := openPDF(data)
+	if err != nil {
+		return nil, err
+	}
+	root := doc.dict(doc.trailer["Root"])
+	if root == nil {
+		return nil, fmt.Errorf("%w: no document catalog", ErrPDFMalformed)
+	}
+	list := doc.pages(root["Pages"], nil, 0, make(map[int]bool))
+	if len(list) == 0 {
+		return nil, fmt.Errorf("%w: no pages", ErrPDFMalformed)
+	}
+
+	info = &DocumentInfo{Type: "pdf", PageCount: len(list), Pages: []DocumentPage{}}
+	meta := doc.dict(doc.trailer["Info"])
+	text := func(key pdfName) string {
+		s, _ := doc.resolve(meta[key]).(pdfString)
+		return strings.TrimSpace(pdfTextString(s))
+	}
+	info.Title = text("Title")
+	info.Author = text("Author")
+	info.Subject = text("Subject")
+	if created := text("CreationDate"); created != "" {
+		info.Created = parsePDFDate(created)
+	}
+	if modified := text("ModDate"); modified != "" {
+		info.Modified = parsePDFDate(modified)
+	}
+
+	fonts := make(map[pdfRef]*pdfFont)
+	decoded := false
+	for i, page := range list {
+		if !pages.Contains(i + 1) {
+			continue
+		}
+		content := doc.pageContent(page.dict)
+		decoded = decoded || len(content) > 0
+		x := &pdfTextExtractor{doc: doc, fonts: fonts}
+		x.run(content, page.resources, 0)
+		info.Pages = append(info.Pages, DocumentPage{Number: i + 1, Text: cleanPDFText(x.out.String())})
+	}
+	// A salvaged file whose pages lost their content is damaged, not blank
+	if doc.rebuilt && !decoded && len(info.Pages) > 0 {
+		return nil, fmt.Errorf("%w: no readable page content", ErrPDFMalformed)
+	}
+	return info, nil
+}
+
+type pdfPage struct {
+	dict      pdfDict
+	resources pdfDict // Own or inherited from the page tree
+}
+
+// pages flattens the page tree in order.
+func (d *pdfDocument) pages(node interface{}, resources pdfDict, depth int, visited map[int]bool) []pdfPage {
+	if ref, ok := node.(pdfRef); ok {
+		if visited[ref.num] {
+			return nil
+		}
+		visited[ref.num] = true
+	}
+	dict := d.dict(node)
+	if dict == nil || depth > pdfMaxDepth {
+		return nil
+	}
+	if own := d.dict(dict["Resources"]); own != nil {
+		resources = own
+	}
+
+	kids := d.array(dict["Kids"])
+	if dict["Type"] == pdfName("Page") || kids == nil {
+		return []pdfPage{{dict: dict, resources: resources}}
+	}
+	var list []pdfPage
+	for _, kid := range kids {
+		list = append(list, d.pages(kid, resources, depth+1, visited)...)
+	}
+	return list
+}
+
+// pageContent concatenates a page's content streams.
+func (d *pdfDocument) pageContent(page pdfDict) []byte {
+	var streams []interface{}
+	switch c := d.resolve(page["Contents"]).(type) {
+	case *pdfStream:
+		streams = []interface{}{c}
+	case pdfArray:
+		streams = c
+	}
+	var buf bytes.Buffer
+	for _, s := range streams {
+		if stream, ok := d.resolve(s).(*pdfStream); ok {
+			if data, err := d.decodeStream(stream); err == nil {
+				buf.Write(data)
+				buf.WriteByte('\n')
+			}
+		}
+	}
+	return buf.Bytes()
+}
+
+// pdfTextExtractor runs a content stream, writing its text in reading order as laid
+// out: a line break where the baseline moves, a blank line for a larger jump, and a
+// space where the gap between strings on a line is wider than kerning.
+type pdfTextExtractor struct {
+	doc   *pdfDocument
+	fonts map[pdfRef]*pdfFont
+	out   strings.Builder
+	pdfTextState
+
+	hasText                bool
+	lastX, lastY, lastSize float64
+}
+
+// pdfTextState is the text state a form XObject may change and must restore.
+type pdfTextState struct {
+	font                     *pdfFont
+	fontSize, leading        float64
+	charSpacing, wordSpacing float64
+	hScale                   float64
+	tm, tlm                  [6]float64
+}
+
+var pdfIdentity = [6]float64{1, 0, 0, 1, 0, 0}
+
+func (x *pdfTextExtractor) run(content []byte, resources pdfDict, depth int) {
+	if depth > 8 {
+		return
+	}
+	x.hScale = 1
+	x.tm, x.tlm = pdfIdentity, pdfIdentity
+
+	l := &pdfLexer{data: content}
+	var operands []interface{}
+	num := func(i int) float64 {
+		if i < len(operands) {
+			f, _ := operands[i].(float64)
+			return f
+		}
+		return 0
+	}
+	for {
+		start := l.pos
+		obj, err := l.object(0)
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			if l.pos == start {
+				l.pos++
+			}
+			operands = operands[:0]
+			continue
+		}
+		op, ok := obj.(pdfKeyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+
+		switch op {
+		case "BT":
+			x.tm, x.tlm = pdfIdentity, pdfIdentity
+		case "Tf":
+			if len(operands) >= 2 {
+				name, _ := operands[0].(pdfName)
+				x.font = x.loadFont(resources, name)
+				x.fontSize = num(1)
+			}
+		case "Td":
+			x.moveLine(num(0), num(1))
+		case "TD":
+			x.leading = -num(1)
+			x.moveLine(num(0), num(1))
+		case "Tm":
+			if len(operands) >= 6 {
+				for i := range x.tm {
+					x.tm[i] = num(i)
+				}
+				x.tlm = x.tm
+			}
+		case "T*":
+			x.moveLine(0, -x.leading)
+		case "TL":
+			x.leading = num(0)
+		case "Tc":
+			x.charSpacing = num(0)
+		case "Tw":
+			x.wordSpacing = num(0)
+		case "Tz":
+			x.hScale = num(0) / 100
+		case "Tj":
+			if len(operands) > 0 {
+				s, _ := operands[0].(pdfString)
+				x.show(s)
+			}
+		case "'":
+			x.moveLine(0, -x.leading)
+			if len(operands) > 0 {
+				s, _ := operands[0].(pdfString)
+				x.show(s)
+			}
+		case "\"":
+			x.wordSpacing, x.charSpacing = num(0), num(1)
+			x.moveLine(0, -x.leading)
+			if len(operands) > 2 {
+				s, _ := operands[2].(pdfString)
+				x.show(s)
+			}
+		case "TJ":
+			if len(operands) > 0 {
+				arr, _ := operands[0].(pdfArray)
+				for _, item := range arr {
+					switch v := item.(type) {
+					case pdfString:
+						x.show(v)
+					case float64:
+						x.advance(-v / 1000 * x.fontSize * x.hScale)
+					}
+				}
+			}
+		case "Do":
+			if len(operands) > 0 {
+				name, _ := operands[0].(pdfName)
+				x.runForm(resources, name, depth)
+			}
+		case "BI":
+			skipInlineImage(l)
+		}
+		operands = operands[:0]
+	}
+}
+
+// runForm extracts the text of a form XObject, which keeps its own resources.
+func (x *pdfTextExtractor) runForm(resources pdfDict, name pdfName, depth int) {
+	form, ok := x.doc.resolve(x.doc.dict(resources["XObject"])[name]).(*pdfStream)
+	if !ok || form.dict["Subtype"] != pdfName("Form") {
+		return
+	}
+	data, err := x.doc.decodeStream(form)
+	if err != nil {
+		return
+	}
+	formResources := x.doc.dict(form.dict["Resources"])
+	if formResources == nil {
+		formResources = resources
+	}
+
+	saved := x.pdfTextState
+	x.run(data, formResources, depth+1)
+	x.pdfTextState = saved
+}
+
+// skipInlineImage moves past the binary data of an inline image (BI ... ID data EI).
+func skipInlineImage(l *pdfLexer) {
+	idx := bytes.Index(l.data[l.pos:], []byte("ID"))
+	if idx < 0 {
+		l.pos = len(l.data)
+		return
+	}
+	l.pos += idx + 3
+	for l.pos < len(l.data) {
+		idx := bytes.Index(l.data[l.pos:], []byte("EI"))
+		if idx < 0 {
+			l.pos = len(l.data)
+			return
+		}
+		at := l.pos + idx
+		l.pos = at + 2
+		if at > 0 && isPDFSpace(l.data[at-1]) && (l.pos >= len(l.data) || isPDFSpace(l.data[l.pos])) {
+			return
+		}
+	}
+}
+
+// moveLine starts a new line offset from the start of the current one (Td).
+func (x *pdfTextExtractor) moveLine(tx, ty float64) {
+	m := x.tlm
+	x.tlm[4] = tx*m[0] + ty*m[2] + m[4]
+	x.tlm[5] = tx*m[1] + ty*m[3] + m[5]
+	x.tm = x.tlm
+}
+
+// advance moves the text position along the baseline by tx text space units.
+func (x *pdfTextExtractor) advance(tx float64) {
+	x.tm[4] += tx * x.tm[0]
+	x.tm[5] += tx * x.tm[1]
+}
+
+func (x *pdfTextExtractor) show(s pdfString) {
+	font := x.font
+	if font == nil {
+		font = defaultPDFFont
+	}
+	size := x.fontSize * math.Hypot(x.tm[2], x.tm[3])
+	if size <= 0 {
+		size = 1
+	}
+	posX, posY := x.tm[4], x.tm[5]
+
+	var text strings.Builder
+	for _, g := range font.decode([]byte(s)) {
+		text.WriteString(g.text)
+		tx := g.width/1000*x.fontSize + x.charSpacing
+		if g.space {
+			tx += x.wordSpacing
+		}
+		x.advance(tx * x.hScale)
+	}
+	if text.Len() == 0 {
+		return
+	}
+
+	if x.hasText {
+		lineSize := math.Max(size, x.lastSize)
+		dy := math.Abs(x.lastY - posY)
+		switch {
+		case dy > 1.7*lineSize:
+			x.out.WriteString("\n\n")
+		case dy > 0.5*lineSize:
+			x.out.WriteString("\n")
+		case math.Abs(posX-x.lastX) > 0.2*lineSize:
+			if !strings.HasSuffix(x.out.String(), " ") && !strings.HasPrefix(text.String(), " ") {
+				x.out.WriteString(" ")
+			}
+		}
+	}
+	x.out.WriteString(text.String())
+	x.hasText = true
+	x.lastX, x.lastY, x.lastSize = x.tm[4], posY, size
+}
+
+func (x *pdfTextExtractor) loadFont(resources pdfDict, name pdfName) *pdfFont {
+	ref := x.doc.dict(resources["Font"])[name]
+	if r, ok := ref.(pdfRef); ok {
+		if font, ok := x.fonts[r]; ok {
+			return font
+		}
+		font := x.doc.buildFont(x.doc.dict(r))
+		x.fonts[r] = font
+		return font
+	}
+	return x.doc.buildFont(x.doc.dict(ref))
+}
+
+var (
+	reRepeatedSpaces = regexp.MustCompile(`[ \t]+`)
+	reManyNewlines   = regexp.MustCompile(`\n{3,}`)
+	pdfLigatures     = strings.NewReplacer("ﬀ", "ff", "ﬁ", "fi", "ﬂ", "fl", "ﬃ", "ffi", "ﬄ", "ffl", " ", " ")
+)
+
+// cleanPDFText drops control characters, expands ligatures and tidies whitespace.
+func cleanPDFText(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' || !unicode.IsControl(r) && r != unicode.ReplacementChar {
+			return r
+		}
+		return -1
+	}, pdfLigatures.Replace(s))
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(reRepeatedSpaces.ReplaceAllString(line, " "))
+	}
+	return strings.TrimSpace(reManyNewlines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
+
+// pdfFont maps a font's character codes to text and glyph widths.
+type pdfFont struct {
+	cmap         *pdfCMap     // From ToUnicode, when the font has one
+	encoding     *[256]string // Simple (single-byte) fonts only
+	widths       map[int]float64
+	defaultWidth float64 // Thousandths of an em
+}
+
+type pdfGlyph struct {
+	text  string
+	width float64
+	space bool // Single-byte code 32, which word spacing applies to
+}
+
+var defaultPDFFont = &pdfFont{encoding: &winAnsiText, defaultWidth: 500}
+
+func (d *pdfDocument) buildFont(dict pdfDict) *pdfFont {
+	font := &pdfFont{widths: make(map[int]float64), defaultWidth: 500}
+	if stream, ok := d.resolve(dict["ToUnicode"]).(*pdfStream); ok {
+		if data, err := d.decodeStream(stream); err == nil {
+			font.cmap = parseCMap(data)
+		}
+	}
+
+	if dict["Subtype"] == pdfName("Type0") {
+		font.defaultWidth = 1000
+		descendants := d.array(dict["DescendantFonts"])
+		if len(descendants) == 0 {
+			return font
+		}
+		cid := d.dict(descendants[0])
+		if dw, ok := d.number(cid["DW"]); ok {
+			font.defaultWidth = dw
+		}
+		w := d.array(cid["W"])
+		for i := 0; i+1 < len(w); {
+			first, _ := d.number(w[i])
+			if arr := d.array(w[i+1]); arr != nil {
+				for j, v := range arr {
+					font.widths[int(first)+j], _ = d.number(v)
+				}
+				i += 2
+				continue
+			}
+			if i+2 >= len(w) {
+				break
+			}
+			last, _ := d.number(w[i+1])
+			width, _ := d.number(w[i+2])
+			for c := int(first); c <= int(last) && c-int(first) < 1<<16; c++ {
+				font.widths[c] = width
+			}
+			i += 3
+		}
+		return font
+	}
+
+	encoding := winAnsiText
+	switch e := d.resolve(dict["Encoding"]).(type) {
+	case pdfName:
+		encoding = *pdfBaseEncoding(e)
+	case pdfDict:
+		if base, ok := d.resolve(e["BaseEncoding"]).(pdfName); ok {
+			encoding = *pdfBaseEncoding(base)
+		}
+		code := 0
+		for _, item := range d.array(e["Differences"]) {
+			switch v := d.resolve(item).(type) {
+			case float64:
+				code = int(v)
+			case pdfName:
+				if code >= 0 && code < 256 {
+					encoding[code] = glyphText(string(v))
+				}
+				code++
+			}
+		}
+	}
+	font.encoding = &encoding
+
+	// Type3 glyph widths are in glyph space, scaled by the font matrix
+	scale := 1.0
+	if m := d.array(dict["FontMatrix"]); len(m) > 0 {
+		if a, ok := d.number(m[0]); ok {
+			scale = a * 1000
+		}
+	}
+	first, _ := d.number(dict["FirstChar"])
+	for i, v := range d.array(dict["Widths"]) {
+		if width, ok := d.number(v); ok {
+			font.widths[int(first)+i] = width * scale
+		}
+	}
+	return font
+}
+
+func pdfBaseEncoding(name pdfName) *[256]string {
+	if name == "MacRomanEncoding" {
+		return &macRomanText
+	}
+	return &winAnsiText
+}
+
+func (f *pdfFont) decode(b []byte) []pdfGlyph {
+	var glyphs []pdfGlyph
+	for i := 0; i < len(b); {
+		n := f.codeLength(b[i:])
+		code := codeValue(b[i : i+n])
+		g := pdfGlyph{width: f.defaultWidth, space: n == 1 && code == 32}
+		if w, ok := f.widths[int(code)]; ok {
+			g.width = w
+		}
+		if text, ok := f.cmap.lookup(n, code); ok {
+			g.text = text
+		} else if f.encoding != nil && n == 1 {
+			g.text = f.encoding[code]
+		}
+		glyphs = append(glyphs, g)
+		i += n
+	}
+	return glyphs
+}
+
+// codeLength is the byte length of the character code at the start of b.
+func (f *pdfFont) codeLength(b []byte) int {
+	if f.cmap != nil {
+		for _, cs := range f.cmap.codespace {
+			if cs.n <= len(b) {
+				if code := codeValue(b[:cs.n]); code >= cs.lo && code <= cs.hi {
+					return cs.n
+				}
+			}
+		}
+	}
+	if f.encoding == nil && len(b) >= 2 {
+		return 2 // Composite fonts default to Identity-H's two-byte codes
+	}
+	return 1
+}
+
+func codeValue(b []byte) uint32 {
+	var v uint32
+	for _, c := range b {
+		v = v<<8 | uint32(c)
+	}
+	return v
+}
+
+// pdfCMap is a parsed ToUnicode CMap.
+type pdfCMap struct {
+	codespace []pdfCodespace
+	chars     map[pdfCode]string
+}
+
+type pdfCodespace struct {
+	n      int
+	lo, hi uint32
+}
+
+type pdfCode struct {
+	n    int
+	code uint32
+}
+
+func (m *pdfCMap) lookup(n int, code uint32) (string, bool) {
+	if m == nil {
+		return "", false
+	}
+	text, ok := m.chars[pdfCode{n, code}]
+	return text, ok
+}
+
+// parseCMap reads the codespace ranges, bfchar and bfrange sections of a CMap.
+func parseCMap(data []byte) *pdfCMap {
+	m := &pdfCMap{chars: make(map[pdfCode]string)}
+	l := &pdfLexer{data: data}
+	var operands []interface{}
+	for {
+		start := l.pos
+		obj, err := l.object(0)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if l.pos == start {
+				l.pos++
+			}
+			continue
+		}
+		op, ok := obj.(pdfKeyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+
+		switch op {
+		case "endcodespacerange":
+			for i := 0; i+1 < len(operands); i += 2 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 && len(lo) == len(hi) && len(lo) > 0 && len(lo) <= 4 {
+					m.codespace = append(m.codespace, pdfCodespace{len(lo), codeValue([]byte(lo)), codeValue([]byte(hi))})
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok := operands[i].(pdfString)
+				if !ok || len(src) == 0 || len(src) > 4 {
+					continue
+				}
+				if text, ok := cmapTarget(operands[i+1]); ok {
+					m.chars[pdfCode{len(src), codeValue([]byte(src))}] = text
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if !ok1 || !ok2 || len(lo) == 0 || len(lo) > 4 {
+					continue
+				}
+				m.addRange(len(lo), codeValue([]byte(lo)), codeValue([]byte(hi)), operands[i+2])
+			}
+		}
+		operands = operands[:0]
+	}
+	return m
+}
+
+func (m *pdfCMap) addRange(n int, lo, hi uint32, target interface{}) {
+	if hi < lo || hi-lo > 1<<16 {
+		return
+	}
+	if arr, ok := target.(pdfArray); ok {
+		for i, item := range arr {
+			if text, ok := cmapTarget(item); ok && lo+uint32(i) <= hi {
+				m.chars[pdfCode{n, lo + uint32(i)}] = text
+			}
+		}
+		return
+	}
+	dst, ok := target.(pdfString)
+	if !ok || len(dst) < 2 {
+		return
+	}
+	// Consecutive codes map to consecutive values of the destination's last UTF-16 unit
+	for code := lo; code <= hi; code++ {
+		b := []byte(dst)
+		last := uint32(b[len(b)-2])<<8 | uint32(b[len(b)-1])
+		last += code - lo
+		b = append(append([]byte(nil), b[:len(b)-2]...), byte(last>>8), byte(last))
+		m.chars[pdfCode{n, code}] = decodeUTF16BE(b)
+	}
+}
+
+// cmapTarget decodes a bfchar destination: UTF-16BE hex, or a glyph name.
+func cmapTarget(obj interface{}) (string, bool) {
+	switch v := obj.(type) {
+	case pdfString:
+		return decodeUTF16BE([]byte(v)), true
+	case pdfName:
+		text := glyphText(string(v))
+		return text, text != ""
+	}
+	return "", false
+}
+
+// glyphText maps an Adobe glyph name to text: known names, uniXXXX and uXXXX[XX]
+// forms, ligatures like f_i, and suffixed variants like a.sc.
+func glyphText(name string) string {
+	if r, ok := glyphNames[name]; ok {
+		return string(r)
+	}
+	if base, _, found := strings.Cut(name, "."); found && base != "" {
+		return glyphText(base)
+	}
+	if strings.Contains(name, "_") {
+		var b strings.Builder
+		for _, part := range strings.Split(name, "_") {
+			b.WriteString(glyphText(part))
+		}
+		return b.String()
+	}
+	if hexDigits, ok := strings.CutPrefix(name, "uni"); ok && len(hexDigits) >= 4 && len(hexDigits)%4 == 0 {
+		var b strings.Builder
+		for i := 0; i < len(hexDigits); i += 4 {
+			v, err := strconv.ParseUint(hexDigits[i:i+4], 16, 16)
+			if err != nil {
+				return ""
+			}
+			b.WriteRune(rune(v))
+		}
+		return b.String()
+	}
+	if hexDigits, ok := strings.CutPrefix(name, "u"); ok && len(hexDigits) >= 4 && len(hexDigits) <= 6 {
+		if v, err := strconv.ParseUint(hexDigits, 16, 32); err == nil {
+			return string(rune(v))
+		}
+	}
+	return ""
+}
+
+// winAnsiEncoding maps WinAnsiEncoding bytes to runes; 0 marks undefined codes.
+var winAnsiEncoding = func() [256]rune {
+	var enc [256]rune
+	for c := 0x20; c < 0x7F; c++ {
+		enc[c] = rune(c)
+	}
+	for c := 0xA0; c <= 0xFF; c++ {
+		enc[c] = rune(c)
+	}
+	copy(enc[0x80:], []rune{
+		'€', 0, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0, 'Ž', 0,
+		0, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0, 'ž', 'Ÿ',
+	})
+	enc['\t'], enc['\n'], enc['\r'] = '\t', '\n', '\r'
+	return enc
+}()
+
+var macRomanHigh = []rune("ÄÅÇÉÑÖÜáàâäãåçéèêëíìîïñóòôöõúùûü†°¢£§•¶ß®©™´¨≠ÆØ∞±≤≥¥µ∂∑∏π∫ªºΩæø¿¡¬√ƒ≈∆«»… ÀÃÕŒœ–—“”‘’÷◊ÿŸ⁄€‹›ﬁﬂ‡·‚„‰ÂÊÁËÈÍÎÏÌÓÔÒÚÛÙıˆ˜¯˘˙˚¸˝˛ˇ")
+
+var winAnsiText, macRomanText = func() ([256]string, [256]string) {
+	var win, mac [256]string
+	for c, r := range winAnsiEncoding {
+		if r != 0 {
+			win[c] = string(r)
+		}
+		if c < 0x80 {
+			mac[c] = win[c]
+		}
+	}
+	for i, r := range macRomanHigh {
+		mac[0x80+i] = string(r)
+	}
+	return win, mac
+}()
+
+// glyphNames maps the Adobe glyph names used by Latin text fonts to runes.
+var glyphNames = func() map[string]rune {
+	names := make(map[string]rune)
+	ascii := strings.Fields(`space exclam quotedbl numbersign dollar percent ampersand quotesingle
+		parenleft parenright asterisk plus comma hyphen period slash zero one two three four five
+		six seven eight nine colon semicolon less equal greater question at`)
+	for i, name := range ascii {
+		names[name] = rune(0x20 + i)
+	}
+	for c := 'A'; c <= 'Z'; c++ {
+		names[string(c)] = c
+		names[string(c+'a'-'A')] = c + 'a' - 'A'
+	}
+	for i, name := range strings.Fields("bracketleft backslash bracketright asciicircum underscore grave") {
+		names[name] = rune(0x5B + i)
+	}
+	for i, name := range strings.Fields("braceleft bar braceright asciitilde") {
+		names[name] = rune(0x7B + i)
+	}
+	latin1 := strings.Fields(`nbspace exclamdown cent sterling currency yen brokenbar section dieresis
+		copyright ordfeminine guillemotleft logicalnot sfthyphen registered macron degree plusminus
+		twosuperior threesuperior acute mu paragraph periodcentered cedilla onesuperior ordmasculine
+		guillemotright onequarter onehalf threequarters questiondown Agrave Aacute Acircumflex Atilde
+		Adieresis Aring AE Ccedilla Egrave Eacute Ecircumflex Edieresis Igrave Iacute Icircumflex
+		Idieresis Eth Ntilde Ograve Oacute Ocircumflex Otilde Odieresis multiply Oslash Ugrave Uacute
+		Ucircumflex Udieresis Yacute Thorn germandbls agrave aacute acircumflex atilde adieresis aring
+		ae ccedilla egrave eacute ecircumflex edieresis igrave iacute icircumflex idieresis eth ntilde
+		ograve oacute ocircumflex otilde odieresis divide oslash ugrave uacute ucircumflex udieresis
+		yacute thorn ydieresis`)
+	for i, name := range latin1 {
+		names[name] = rune(0xA0 + i)
+	}
+	for name, r := range map[string]rune{
+		"Euro": '€', "quotesinglbase": '‚', "florin": 'ƒ', "quotedblbase": '„', "ellipsis": '…',
+		"dagger": '†', "daggerdbl": '‡', "circumflex": 'ˆ', "perthousand": '‰', "Scaron": 'Š',
+		"guilsinglleft": '‹', "OE": 'Œ', "Zcaron": 'Ž', "quoteleft": '‘', "quoteright": '’',
+		"quotedblleft": '“', "quotedblright": '”', "bullet": '•', "endash": '–', "emdash": '—',
+		"tilde": '˜', "trademark": '™', "scaron": 'š', "guilsinglright": '›', "oe": 'œ',
+		"zcaron": 'ž', "Ydieresis": 'Ÿ', "dotlessi": 'ı', "Lslash": 'Ł', "lslash": 'ł',
+		"minus": '−', "fraction": '⁄', "nonbreakingspace": ' ', "mu1": 'µ',
+		"fi": 'ﬁ', "fl": 'ﬂ', "ff": 'ﬀ', "ffi": 'ﬃ', "ffl": 'ﬄ',
+	} {
+		names[name] = r
+	}
+	return names
+}()
@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"math"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// MinContentQuality is the score below which static extraction is considered thin
+// and worth retrying on the browser-rendered page.
+const MinContentQuality = 0.35
+
+// Word count at which content counts as substantial
+const qualityFullWords = 150
+
+// Phrases pages show when they can't work without JavaScript
+var reJSRequired = regexp.MustCompile(`(?i)(enable|turn on|activate)\s+javascript|javascript\s+(is\s+)?(required|disabled|must be enabled)|requires?\s+javascript|browser (does not|doesn't) support javascript`)
+
+// Ids of the empty mount points single-page apps render into
+var appMountIDs = map[string]bool{
+	"root": true, "app": true, "__next": true, "__nuxt": true, "___gatsby": true, "svelte": true, "main-app": true,
+}
+
+// ContentQuality rates how complete an extraction looks.
+type ContentQuality struct {
+	Score       float64  `json:"score"` // 0 (nothing useful) to 1
+	Words       int      `json:"words"`
+	LinkDensity float64  `json:"link_density"`
+	JSRequired  bool     `json:"js_required,omitempty"` // The page signals it needs JavaScript
+	Reasons     []string `json:"reasons,omitempty"`     // Why the score is low
+}
+
+// Quality scores the extraction on word count and link density, and heavily
+// penalises short content from pages that say they need JavaScript.
+func (e *Extraction) Quality() ContentQuality {
+	text := e.Text()
+	q := ContentQuality{
+		Words:       len(strings.Fields(text)),
+		LinkDensity: math.Round(getLinkDensity(e.Node)*1000) / 1000,
+	}
+
+	wordScore := math.Min(1, float64(q.Words)/qualityFullWords)
+	q.Score = 0.8*wordScore + 0.2*(1-q.LinkDensity)
+	if q.Words < qualityFullWords {
+		q.Reasons = append(q.Reasons, "few words")
+	}
+	if q.LinkDensity > 0.5 {
+		q.Reasons = append(q.Reasons, "mostly links")
+	}
+
+	q.JSRequired = reJSRequired.MatchString(text)
+	for _, source := range e.sources {
+		if requiresJavaScript(source.doc) {
+			q.JSRequired = true
+		}
+	}
+	if q.JSRequired && q.Words < qualityFullWords {
+		q.Score *= 0.3
+		q.Reasons = append(q.Reasons, "page requires JavaScript")
+	}
+
+	q.Score = math.Round(q.Score*1000) / 1000
+	return q
+}
+
+// requiresJavaScript looks for a "please enable JavaScript" notice or an empty app mount point.
+func requiresJavaScript(doc *html.Node) bool {
+	for _, n := range findAll(doc, "noscript") {
+		// x/net/html keeps noscript content as raw text when scripting is assumed on
+		if reJSRequired.MatchString(getTextContent(n)) {
+			return true
+		}
+	}
+	for _, n := range findAll(doc, "div", "main", "section") {
+		if appMountIDs[getAttr(n, "id")] && innerText(n) == "" {
+			return true
+		}
+	}
+	return false
+}
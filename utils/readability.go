@@ -2,54 +2,181 @@ package utils
 
 import (
 	"fmt"
-	"net/url"
+	"math"
 	"regexp"
+	"sort"
 	"strings"
 
+	"github.com/EasterCompany/dex-web-service/config"
 	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Extraction flags. Each pass that finds too little text drops the next one, in order.
+const (
+	flagStripUnlikelys = 1 << iota
+	flagWeightClasses
+	flagCleanConditionally
 )
 
 // ReadabilityConfig holds settings for the extraction
 type ReadabilityConfig struct {
-	MinTextLength int
+	MinTextLength   int // A pass that yields fewer characters is retried with relaxed flags
+	NbTopCandidates int // How many top candidates are compared when looking for a shared ancestor
 }
 
-// ExtractMainContent analyzes the HTML doc and returns the main article content as Markdown
-func ExtractMainContent(doc *html.Node, pageURL string) (string, error) {
-	// 1. Clean the DOM (remove scripts, styles, navs, footers, etc.)
-	cleanDOM(doc)
+// DefaultReadabilityConfig mirrors the defaults of Mozilla's Readability.js.
+var DefaultReadabilityConfig = ReadabilityConfig{
+	MinTextLength:   500,
+	NbTopCandidates: 5,
+}
 
-	// 2. Score candidates
+var reSentenceEnd = regexp.MustCompile(`\.( |$)`)
 
-	candidates := make(map[*html.Node]float64)
-	scoreNode(doc, candidates)
+// Elements a div may contain and still be treated as a paragraph
+var divToPElems = map[string]bool{
+	"blockquote": true, "dl": true, "div": true, "img": true, "ol": true,
+	"p": true, "pre": true, "table": true, "ul": true, "select": true,
+}
 
-	// 3. Find the winner
-	var topNode *html.Node
-	var topScore float64
+// Inline content that gets wrapped into paragraphs when loose inside a div
+var phrasingElems = map[string]bool{
+	"abbr": true, "audio": true, "b": true, "bdo": true, "br": true, "button": true,
+	"cite": true, "code": true, "data": true, "datalist": true, "dfn": true, "em": true,
+	"embed": true, "i": true, "img": true, "input": true, "kbd": true, "label": true,
+	"mark": true, "math": true, "meter": true, "noscript": true, "object": true,
+	"output": true, "progress": true, "q": true, "ruby": true, "samp": true, "script": true,
+	"select": true, "small": true, "span": true, "strong": true, "sub": true, "sup": true,
+	"textarea": true, "time": true, "var": true, "wbr": true,
+}
+
+// Extraction is the main content picked out of a document, by a per-domain rule or by Readability.
+type Extraction struct {
+	Node    *html.Node // Detached copy of the content; the caller's document is untouched
+	PageURL string
+
+	// Set when a per-domain rule provides the selector, or from a document's metadata
+	Title     string
+	Author    string
+	Published string
+	Rule      *config.ExtractionRule
+
+	origins map[*html.Node]*html.Node // Copied node -> node in the caller's document
+	matches []*html.Node              // Set by Select
+	sources []pageSource              // Documents the content came from, more than one once pages are appended
+}
 
-	for node, score := range candidates {
-		if score > topScore {
-			topScore = score
-			topNode = node
+// pageSource is a document an extraction was taken from.
+type pageSource struct {
+	doc *html.Node
+	url string
+}
+
+// ExtractMainContent analyzes the HTML doc and returns the main article content as
+// Markdown, with a score of how complete it looks.
+func ExtractMainContent(doc *html.Node, pageURL string) (string, ContentQuality, error) {
+	extraction, err := Extract(doc, pageURL)
+	if err != nil {
+		return "", ContentQuality{Reasons: []string{"no content found"}}, err
+	}
+	return extraction.Markdown(), extraction.Quality(), nil
+}
+
+// Extract returns the main content of doc. A matching per-domain rule is applied
+// first; Readability's heuristics run when there is none or its selectors find nothing.
+func Extract(doc *html.Node, pageURL string) (*Extraction, error) {
+	return extract(doc, pageURL, nil)
+}
+
+// extract is Extract with extra selectors whose matches are removed before any extraction.
+func extract(doc *html.Node, pageURL string, strip []*Selector) (*Extraction, error) {
+	rule := matchExtractionRule(pageURL)
+	if rule != nil {
+		if extraction := extractWithRule(doc, pageURL, rule, strip); extraction != nil {
+			return extraction, nil
 		}
 	}
 
-	// Fallback: if no winner found (e.g. really flat structure), use body
-	if topNode == nil {
-		topNode = findBody(doc)
+	if rule != nil {
+		strip = append(strip, compileSelectors(rule.Strip)...)
+	}
+	boilerplate := learnedBoilerplate(doc, pageURL)
+	node, origins, err := extractContentNode(doc, DefaultReadabilityConfig, strip, boilerplate)
+	if err != nil {
+		return nil, err
 	}
-	if topNode == nil {
-		return "", fmt.Errorf("could not find content body")
+
+	extraction := &Extraction{Node: node, PageURL: pageURL, origins: origins, sources: []pageSource{{doc, pageURL}}}
+	applyRuleMetadata(extraction, doc, rule)
+	return extraction, nil
+}
+
+// Markdown renders the content as Markdown with inline links.
+func (e *Extraction) Markdown() string {
+	return e.MarkdownWith(MarkdownOptions{})
+}
+
+// MarkdownWith renders the content as Markdown, writing links as opts asks.
+func (e *Extraction) MarkdownWith(opts MarkdownOptions) string {
+	r := newMarkdownRenderer(e.PageURL, false)
+	r.links, r.maxLinks = opts.Links, opts.MaxLinks
+
+	md := r.render(e.Node)
+	if definitions := r.linkDefinitions(); definitions != "" {
+		md += "\n\n" + definitions
 	}
+	return cleanMarkdown(md)
+}
 
-	// 4. Convert top node to Markdown
-	markdown := nodeToMarkdown(topNode, pageURL)
-	return cleanMarkdown(markdown), nil
+// extractContentNode runs Readability passes over copies of doc, relaxing one flag at
+// a time until a pass finds enough text. Elements matching strip, and copies of the
+// elements in boilerplate, are removed first.
+// The returned node is detached from doc; the map leads from its nodes back to their originals.
+func extractContentNode(doc *html.Node, cfg ReadabilityConfig, strip []*Selector, boilerplate map[*html.Node]bool) (*html.Node, map[*html.Node]*html.Node, error) {
+	flags := flagStripUnlikelys | flagWeightClasses | flagCleanConditionally
+
+	var best *html.Node
+	var bestOrigins map[*html.Node]*html.Node
+	bestLength := -1
+	for {
+		origins := make(map[*html.Node]*html.Node)
+		page := cloneTree(doc, origins)
+		removeMatches(page, strip)
+		removeCopies(origins, boilerplate)
+		cleanDOM(page, flags&flagStripUnlikelys != 0)
+		replaceBrs(page)
+
+		if article := grabArticle(page, flags, cfg); article != nil {
+			length := len(innerText(article))
+			if length >= cfg.MinTextLength {
+				return article, origins, nil
+			}
+			// Keep the longest attempt in case no pass reaches the threshold
+			if length > bestLength {
+				best, bestOrigins, bestLength = article, origins, length
+			}
+		}
+
+		switch {
+		case flags&flagStripUnlikelys != 0:
+			flags &^= flagStripUnlikelys
+		case flags&flagWeightClasses != 0:
+			flags &^= flagWeightClasses
+		case flags&flagCleanConditionally != 0:
+			flags &^= flagCleanConditionally
+		default:
+			if best == nil {
+				return nil, nil, fmt.Errorf("could not find content body")
+			}
+			return best, bestOrigins, nil
+		}
+	}
 }
 
-// cleanDOM removes noise tags and comments
-func cleanDOM(n *html.Node) {
+// cleanDOM removes noise tags, hidden elements and, when stripUnlikelys is set,
+// elements whose class or id words mark them as page furniture. Furniture-like
+// elements holding most of the page's text are kept.
+func cleanDOM(n *html.Node, stripUnlikelys bool) {
 	// Tags to aggressively strip
 	noisyTags := map[string]bool{
 		"script": true, "style": true, "svg": true, "form": true,
@@ -58,37 +185,33 @@ func cleanDOM(n *html.Node) {
 		"textarea": true, "select": true, "option": true,
 	}
 
+	noise := currentNoiseMatcher()
+	totalText := visibleTextLength(n)
+	protected := func(node *html.Node) bool {
+		return totalText > 0 && float64(visibleTextLength(node)) > noiseProtectedTextShare*float64(totalText)
+	}
+
 	var toRemove []*html.Node
 
 	var walk func(*html.Node)
 	walk = func(n *html.Node) {
+		if n.Type == html.CommentNode {
+			toRemove = append(toRemove, n)
+			return
+		}
+
 		if n.Type == html.ElementNode {
-			if noisyTags[n.Data] {
+			if nonContentTags[n.Data] || noisyTags[n.Data] && !protected(n) {
 				toRemove = append(toRemove, n)
 				return // Don't traverse children of removed nodes
 			}
 
-			// Check classes/IDs for noise
-			class := getAttr(n, "class")
-			id := getAttr(n, "id")
-			combined := strings.ToLower(class + " " + id)
-
-			// Simple heuristic filters
-			if strings.Contains(combined, "sidebar") ||
-				strings.Contains(combined, "comment") ||
-				strings.Contains(combined, "popup") ||
-				strings.Contains(combined, "cookie") ||
-				strings.Contains(combined, "ad-") ||
-				strings.Contains(combined, "widget") ||
-				strings.Contains(combined, "promo") ||
-				strings.Contains(combined, "newsletter") ||
-				strings.Contains(combined, "trending") ||
-				strings.Contains(combined, "related") ||
-				strings.Contains(combined, "popular") ||
-				strings.Contains(combined, "social") ||
-				strings.Contains(combined, "share") ||
-				strings.Contains(combined, "more-from") ||
-				strings.Contains(combined, "more_from") {
+			if isHiddenElement(n) && !protected(n) {
+				toRemove = append(toRemove, n)
+				return
+			}
+
+			if stripUnlikelys && isUnlikelyCandidate(n, noise) && !protected(n) {
 				toRemove = append(toRemove, n)
 				return
 			}
@@ -109,6 +232,484 @@ func cleanDOM(n *html.Node) {
 	}
 }
 
+// isUnlikelyCandidate reports whether an element's class/id or role marks it as noise.
+func isUnlikelyCandidate(n *html.Node, noise *noiseMatcher) bool {
+	switch n.Data {
+	case "html", "body", "a", "article", "main":
+		return false
+	}
+
+	if noise.isNoise(n) && !hasAncestorTag(n, "table") && !hasAncestorTag(n, "code") {
+		return true
+	}
+
+	switch getAttr(n, "role") {
+	case "menu", "menubar", "complementary", "navigation", "alert", "alertdialog", "dialog":
+		return true
+	}
+	return false
+}
+
+// replaceBrs turns runs of two or more <br>s into paragraph breaks, wrapping the
+// inline content that follows in a <p>.
+func replaceBrs(doc *html.Node) {
+	var brs []*html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "br" {
+			brs = append(brs, n)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	for _, br := range brs {
+		if br.Parent == nil {
+			continue // Removed as part of an earlier chain
+		}
+
+		// Remove the rest of the chain, keeping the first <br>
+		replaced := false
+		for next := nextSignificant(br.NextSibling); next != nil && isTag(next, "br"); next = nextSignificant(br.NextSibling) {
+			replaced = true
+			removeUntil(br.NextSibling, next)
+		}
+		if !replaced {
+			continue
+		}
+
+		parent := br.Parent
+		p := newElement("p", atom.P)
+		parent.InsertBefore(p, br)
+		parent.RemoveChild(br)
+
+		// Gather following inline content until the next <br><br> or a block element
+		for next := p.NextSibling; next != nil; {
+			if isTag(next, "br") {
+				if after := nextSignificant(next.NextSibling); after != nil && isTag(after, "br") {
+					break
+				}
+			}
+			if !isPhrasingContent(next) {
+				break
+			}
+			sibling := next.NextSibling
+			parent.RemoveChild(next)
+			p.AppendChild(next)
+			next = sibling
+		}
+
+		for p.LastChild != nil && isWhitespace(p.LastChild) {
+			p.RemoveChild(p.LastChild)
+		}
+
+		// A paragraph can't hold another one
+		if parent.Type == html.ElementNode && parent.Data == "p" {
+			setNodeTag(parent, "div", atom.Div)
+		}
+	}
+}
+
+// removeUntil removes from and every sibling after it up to and including to.
+func removeUntil(from, to *html.Node) {
+	for n := from; n != nil; {
+		next := n.NextSibling
+		n.Parent.RemoveChild(n)
+		if n == to {
+			return
+		}
+		n = next
+	}
+}
+
+// grabArticle scores paragraphs into their ancestors, picks the best container and
+// merges in related siblings. Returns nil if the page has no body.
+func grabArticle(page *html.Node, flags int, cfg ReadabilityConfig) *html.Node {
+	body := findBody(page)
+	if body == nil {
+		return nil
+	}
+
+	elementsToScore := collectElementsToScore(body)
+
+	// Score paragraphs into up to five levels of ancestors
+	scores := make(map[*html.Node]float64)
+	var candidates []*html.Node
+	for _, el := range elementsToScore {
+		if el.Parent == nil {
+			continue
+		}
+		text := innerText(el)
+		if len(text) < 25 {
+			continue
+		}
+
+		ancestors := nodeAncestors(el, 5)
+		if len(ancestors) == 0 {
+			continue
+		}
+
+		// One point for the paragraph, one per comma, one per 100 characters (max 3)
+		score := 1 + float64(strings.Count(text, ",")) + math.Min(math.Floor(float64(len(text))/100), 3)
+
+		for level, ancestor := range ancestors {
+			if ancestor.Type != html.ElementNode || ancestor.Parent == nil || ancestor.Parent.Type != html.ElementNode {
+				continue
+			}
+			if _, ok := scores[ancestor]; !ok {
+				scores[ancestor] = initialScore(ancestor, flags)
+				candidates = append(candidates, ancestor)
+			}
+
+			divider := 1.0
+			switch {
+			case level == 1:
+				divider = 2
+			case level > 1:
+				divider = float64(level * 3)
+			}
+			scores[ancestor] += score / divider
+		}
+	}
+
+	// Scale by link density; navigation-heavy containers sink
+	for _, c := range candidates {
+		scores[c] *= 1 - getLinkDensity(c)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return scores[candidates[i]] > scores[candidates[j]] })
+	if len(candidates) > cfg.NbTopCandidates {
+		candidates = candidates[:cfg.NbTopCandidates]
+	}
+
+	var topCandidate *html.Node
+	if len(candidates) > 0 {
+		topCandidate = candidates[0]
+	}
+
+	if topCandidate == nil || topCandidate == body {
+		// Nothing stood out: take the whole body
+		topCandidate = newElement("div", atom.Div)
+		for c := body.FirstChild; c != nil; {
+			next := c.NextSibling
+			body.RemoveChild(c)
+			topCandidate.AppendChild(c)
+			c = next
+		}
+		body.AppendChild(topCandidate)
+		scores[topCandidate] = initialScore(topCandidate, flags)
+	} else {
+		topCandidate = refineTopCandidate(topCandidate, candidates[1:], body, scores, flags)
+	}
+
+	article := mergeSiblings(topCandidate, scores)
+	prepArticle(article, flags, scores)
+	return article
+}
+
+// collectElementsToScore walks the body, normalising divs into paragraphs the way
+// Readability does, and returns the paragraph-like elements worth scoring.
+func collectElementsToScore(body *html.Node) []*html.Node {
+	var elements []*html.Node
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type != html.ElementNode {
+			return
+		}
+
+		switch n.Data {
+		case "section", "h2", "h3", "h4", "h5", "h6", "p", "td", "pre":
+			elements = append(elements, n)
+		case "div":
+			wrapPhrasingContent(n)
+
+			// Sites that wrap every paragraph in its own div
+			if child := singleChildElement(n); child != nil && child.Data == "p" && getLinkDensity(n) < 0.25 {
+				n.RemoveChild(child)
+				n.Parent.InsertBefore(child, n)
+				n.Parent.RemoveChild(n)
+				n = child
+				elements = append(elements, n)
+			} else if !hasChildBlockElement(n) {
+				setNodeTag(n, "p", atom.P)
+				elements = append(elements, n)
+			}
+		}
+
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			walk(c)
+			c = next
+		}
+	}
+	walk(body)
+	return elements
+}
+
+// wrapPhrasingContent puts runs of loose inline content inside a div into paragraphs.
+func wrapPhrasingContent(div *html.Node) {
+	var p *html.Node
+	for c := div.FirstChild; c != nil; {
+		next := c.NextSibling
+		if isPhrasingContent(c) {
+			if p != nil {
+				div.RemoveChild(c)
+				p.AppendChild(c)
+			} else if !isWhitespace(c) {
+				p = newElement("p", atom.P)
+				div.InsertBefore(p, c)
+				div.RemoveChild(c)
+				p.AppendChild(c)
+			}
+		} else if p != nil {
+			for p.LastChild != nil && isWhitespace(p.LastChild) {
+				p.RemoveChild(p.LastChild)
+			}
+			p = nil
+		}
+		c = next
+	}
+}
+
+// refineTopCandidate looks for a better container than the highest scorer: a common
+// ancestor of several strong candidates, or a parent that scores higher still.
+func refineTopCandidate(top *html.Node, others []*html.Node, body *html.Node, scores map[*html.Node]float64, flags int) *html.Node {
+	const minimumTopCandidates = 3
+
+	// Several near-equal candidates usually means the article is split into blocks
+	var alternativeAncestors [][]*html.Node
+	for _, c := range others {
+		if scores[c]/scores[top] >= 0.75 {
+			alternativeAncestors = append(alternativeAncestors, nodeAncestors(c, 0))
+		}
+	}
+	if len(alternativeAncestors) >= minimumTopCandidates {
+		for parent := top.Parent; parent != nil && parent != body && parent.Type == html.ElementNode; parent = parent.Parent {
+			shared := 0
+			for _, ancestors := range alternativeAncestors {
+				for _, a := range ancestors {
+					if a == parent {
+						shared++
+						break
+					}
+				}
+			}
+			if shared >= minimumTopCandidates {
+				top = parent
+				break
+			}
+		}
+	}
+	if _, ok := scores[top]; !ok {
+		scores[top] = initialScore(top, flags)
+	}
+
+	// Climb while the parent keeps scoring higher; content is often spread over siblings
+	lastScore := scores[top]
+	threshold := lastScore / 3
+	for parent := top.Parent; parent != nil && parent != body && parent.Type == html.ElementNode; parent = parent.Parent {
+		parentScore, ok := scores[parent]
+		if !ok {
+			continue
+		}
+		if parentScore < threshold {
+			break
+		}
+		if parentScore > lastScore {
+			top = parent
+			break
+		}
+		lastScore = parentScore
+	}
+
+	// A lone child carries no more information than its parent
+	for parent := top.Parent; parent != nil && parent != body && parent.Type == html.ElementNode && elementChildCount(parent) == 1; parent = top.Parent {
+		top = parent
+	}
+	if _, ok := scores[top]; !ok {
+		scores[top] = initialScore(top, flags)
+	}
+	return top
+}
+
+// mergeSiblings builds the article from the top candidate plus any siblings that
+// look like part of the same content.
+func mergeSiblings(top *html.Node, scores map[*html.Node]float64) *html.Node {
+	article := newElement("div", atom.Div)
+	topScore := scores[top]
+	threshold := math.Max(10, topScore*0.2)
+	topClass := getAttr(top, "class")
+
+	siblings := []*html.Node{top}
+	if top.Parent != nil {
+		siblings = siblings[:0]
+		for c := top.Parent.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode {
+				siblings = append(siblings, c)
+			}
+		}
+	}
+
+	for _, sibling := range siblings {
+		include := sibling == top
+		if !include {
+			bonus := 0.0
+			if topClass != "" && getAttr(sibling, "class") == topClass {
+				bonus = topScore * 0.2
+			}
+
+			if score, ok := scores[sibling]; ok && score+bonus >= threshold {
+				include = true
+			} else if sibling.Data == "p" {
+				density := getLinkDensity(sibling)
+				text := innerText(sibling)
+				switch {
+				case len(text) > 80 && density < 0.25:
+					include = true
+				case len(text) < 80 && len(text) > 0 && density == 0 && reSentenceEnd.MatchString(text):
+					include = true
+				}
+			}
+		}
+
+		if include {
+			if sibling.Parent != nil {
+				sibling.Parent.RemoveChild(sibling)
+			}
+			switch sibling.Data {
+			case "div", "article", "section", "p":
+			default:
+				setNodeTag(sibling, "div", atom.Div)
+			}
+			article.AppendChild(sibling)
+		}
+	}
+	return article
+}
+
+// prepArticle removes leftovers from the chosen article: weak headers, empty
+// paragraphs and, when enabled, blocks that look like lists of links or ads.
+func prepArticle(article *html.Node, flags int, scores map[*html.Node]float64) {
+	if flags&flagCleanConditionally != 0 {
+		for _, tag := range []string{"table", "ul", "div"} {
+			cleanConditionally(article, tag, flags, scores)
+		}
+	}
+
+	for _, el := range findAll(article, "h1", "h2") {
+		if classWeight(el, flags) < 0 {
+			el.Parent.RemoveChild(el)
+		}
+	}
+
+	for _, p := range findAll(article, "p") {
+		if strings.TrimSpace(getTextContent(p)) == "" && len(findAll(p, "img", "embed", "object", "iframe")) == 0 {
+			p.Parent.RemoveChild(p)
+		}
+	}
+}
+
+// cleanConditionally removes tag elements that don't look like content: too many
+// links, images or inputs for the amount of text, or a negative class weight.
+func cleanConditionally(article *html.Node, tag string, flags int, scores map[*html.Node]float64) {
+	isList := tag == "ul" || tag == "ol"
+
+	nodes := findAll(article, tag)
+	// Innermost first, so a removed parent doesn't hide its children's verdicts
+	for i := len(nodes) - 1; i >= 0; i-- {
+		node := nodes[i]
+		if node.Parent == nil || hasDetachedAncestor(node, article) {
+			continue
+		}
+		if tag == "table" && isDataTable(node) {
+			continue
+		}
+		if hasAncestorTag(node, "pre") || hasAncestorTag(node, "code") {
+			continue
+		}
+
+		weight := classWeight(node, flags)
+		if float64(weight)+scores[node] < 0 {
+			node.Parent.RemoveChild(node)
+			continue
+		}
+
+		text := innerText(node)
+		if strings.Count(text, ",") >= 10 {
+			continue
+		}
+
+		p := float64(len(findAll(node, "p")))
+		img := float64(len(findAll(node, "img")))
+		li := float64(len(findAll(node, "li")) - 100)
+		input := float64(len(findAll(node, "input")))
+		embeds := len(findAll(node, "embed", "object", "iframe"))
+		density := getLinkDensity(node)
+		contentLength := len(text)
+		inFigure := hasAncestorTag(node, "figure")
+
+		remove := (img > 1 && p/img < 0.5 && !inFigure) ||
+			(!isList && li > p) ||
+			(input > math.Floor(p/3)) ||
+			(!isList && contentLength < 25 && (img == 0 || img > 2) && !inFigure) ||
+			(!isList && weight < 25 && density > 0.2) ||
+			(weight >= 25 && density > 0.5) ||
+			(embeds == 1 && contentLength < 75) || embeds > 1
+		if remove {
+			node.Parent.RemoveChild(node)
+		}
+	}
+}
+
+// isDataTable reports whether a table holds data rather than page layout.
+func isDataTable(table *html.Node) bool {
+	if getAttr(table, "role") == "presentation" {
+		return false
+	}
+	if getAttr(table, "summary") != "" || len(findAll(table, "caption", "thead", "th", "tfoot", "colgroup", "col")) > 0 {
+		return true
+	}
+	// Layout tables nest; data tables don't
+	if len(findAll(table, "table")) > 0 {
+		return false
+	}
+	rows := findAll(table, "tr")
+	columns := 0
+	for _, row := range rows {
+		columns = max(columns, len(findAll(row, "td")))
+	}
+	return len(rows) >= 10 || columns > 4 || len(rows)*columns > 10
+}
+
+// initialScore is the score a node starts with when it first becomes a candidate.
+func initialScore(n *html.Node, flags int) float64 {
+	score := 0.0
+	switch n.Data {
+	case "div":
+		score = 5
+	case "pre", "td", "blockquote":
+		score = 3
+	case "address", "ol", "ul", "dl", "dd", "dt", "li", "form":
+		score = -3
+	case "h1", "h2", "h3", "h4", "h5", "h6", "th":
+		score = -5
+	}
+	return score + float64(classWeight(n, flags))
+}
+
+// classWeight scores an element's class and id against the positive/negative words,
+// matched on whole words like the noise rules.
+func classWeight(n *html.Node, flags int) int {
+	if flags&flagWeightClasses == 0 {
+		return 0
+	}
+
+	noise := currentNoiseMatcher()
+	return noise.weight(getAttr(n, "class")) + noise.weight(getAttr(n, "id"))
+}
+
 // getLinkDensity calculates the ratio of text inside links vs total text
 func getLinkDensity(n *html.Node) float64 {
 	totalText := getTextContent(n)
@@ -133,136 +734,160 @@ func getLinkDensity(n *html.Node) float64 {
 	return float64(len(linkText)) / float64(len(totalText))
 }
 
-// scoreNode traverses and assigns points to potential containers
-func scoreNode(n *html.Node, candidates map[*html.Node]float64) {
-	if n.Type == html.ElementNode {
-		// Only score block-level containers that contain text
-		if n.Data == "p" || n.Data == "article" || n.Data == "section" || n.Data == "div" || n.Data == "main" {
-			text := getTextContent(n)
-			words := strings.Fields(text)
-			wordCount := len(words)
-
-			if wordCount < 10 {
-				return // Too short to be main content
-			}
-
-			score := float64(0)
-
-			// Base points for structure
-			switch n.Data {
-			case "article":
-				score += 20
-			case "main":
-				score += 15
-			case "section":
-				score += 5
-			}
-
-			// Points for content volume
-			score += float64(wordCount) * 0.5
-
-			// Points for commas (indicative of prose)
-			score += float64(strings.Count(text, ",")) * 1.5
+// nodeAncestors returns up to maxDepth ancestors of n, nearest first (0 means all).
+func nodeAncestors(n *html.Node, maxDepth int) []*html.Node {
+	var ancestors []*html.Node
+	for p := n.Parent; p != nil; p = p.Parent {
+		ancestors = append(ancestors, p)
+		if maxDepth > 0 && len(ancestors) == maxDepth {
+			break
+		}
+	}
+	return ancestors
+}
 
-			// Adjust based on class/id hints
-			class := getAttr(n, "class")
-			id := getAttr(n, "id")
-			hints := strings.ToLower(class + " " + id)
+func hasAncestorTag(n *html.Node, tag string) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.Type == html.ElementNode && p.Data == tag {
+			return true
+		}
+	}
+	return false
+}
 
-			if strings.Contains(hints, "article") || strings.Contains(hints, "content") || strings.Contains(hints, "post") || strings.Contains(hints, "body") {
-				score += 10
-			}
-			if strings.Contains(hints, "nav") || strings.Contains(hints, "menu") {
-				score -= 20
-			}
+// hasDetachedAncestor reports whether n has been cut out of root by an earlier removal.
+func hasDetachedAncestor(n, root *html.Node) bool {
+	for p := n; p != nil; p = p.Parent {
+		if p == root {
+			return false
+		}
+	}
+	return true
+}
 
-			// Link Density Penalty: If more than 50% of the text is links, it's likely a list/navigation
-			density := getLinkDensity(n)
-			if density > 0.5 {
-				score *= 0.1
-			}
+func hasChildBlockElement(n *html.Node) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && (divToPElems[c.Data] || hasChildBlockElement(c)) {
+			return true
+		}
+	}
+	return false
+}
 
-			// Assign score to this node AND bubble up some score to parent
-			candidates[n] += score
-			if n.Parent != nil {
-				candidates[n.Parent] += score * 0.3 // Parent gets partial credit
+// singleChildElement returns n's only element child, provided there is no loose text beside it.
+func singleChildElement(n *html.Node) *html.Node {
+	var only *html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		switch {
+		case c.Type == html.ElementNode:
+			if only != nil {
+				return nil
 			}
+			only = c
+		case c.Type == html.TextNode && strings.TrimSpace(c.Data) != "":
+			return nil
 		}
 	}
+	return only
+}
 
+func elementChildCount(n *html.Node) int {
+	count := 0
 	for c := n.FirstChild; c != nil; c = c.NextSibling {
-		scoreNode(c, candidates)
+		if c.Type == html.ElementNode {
+			count++
+		}
 	}
+	return count
 }
 
-// nodeToMarkdown converts the DOM subtree to Markdown
-func nodeToMarkdown(n *html.Node, baseURL string) string {
-	var sb strings.Builder
-	var walk func(*html.Node)
-	walk = func(node *html.Node) {
-		if node.Type == html.TextNode {
-			text := strings.TrimSpace(node.Data)
-			if text != "" {
-				sb.WriteString(text + " ")
+func isPhrasingContent(n *html.Node) bool {
+	if n.Type == html.TextNode {
+		return true
+	}
+	if n.Type != html.ElementNode {
+		return false
+	}
+	if phrasingElems[n.Data] {
+		return true
+	}
+	if n.Data == "a" || n.Data == "del" || n.Data == "ins" {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if !isPhrasingContent(c) {
+				return false
 			}
-			return
 		}
+		return true
+	}
+	return false
+}
 
-		if node.Type == html.ElementNode {
-			switch node.Data {
-			case "h1":
-				sb.WriteString("\n# ")
-			case "h2":
-				sb.WriteString("\n## ")
-			case "h3":
-				sb.WriteString("\n### ")
-			case "p":
-				sb.WriteString("\n\n")
-			case "br":
-				sb.WriteString("\n")
-			case "li":
-				sb.WriteString("\n- ")
-			case "a":
-				href := getAttr(node, "href")
-				if href != "" {
-					// Resolve relative URLs
-					if baseURL != "" {
-						u, err := url.Parse(href)
-						if err == nil {
-							base, err := url.Parse(baseURL)
-							if err == nil {
-								href = base.ResolveReference(u).String()
-							}
-						}
-					}
+func isWhitespace(n *html.Node) bool {
+	return (n.Type == html.TextNode && strings.TrimSpace(n.Data) == "") || isTag(n, "br")
+}
 
-					linkText := strings.TrimSpace(getTextContent(node))
-					// RULE: Only format as a Markdown link if the text is short (likely a title or button)
-					// If it's a massive block of text, just output the text to avoid syntactic mess.
-					if len(linkText) > 0 && len(linkText) < 200 {
-						sb.WriteString(fmt.Sprintf(" [%s](%s) ", linkText, href))
-					} else {
-						sb.WriteString(linkText + " ")
+// nextSignificant skips whitespace-only text nodes.
+func nextSignificant(n *html.Node) *html.Node {
+	for n != nil && n.Type != html.ElementNode && strings.TrimSpace(n.Data) == "" {
+		n = n.NextSibling
+	}
+	return n
+}
+
+func isTag(n *html.Node, tag string) bool {
+	return n != nil && n.Type == html.ElementNode && n.Data == tag
+}
+
+// findAll returns every descendant element of n with one of the given tags, in document order.
+func findAll(n *html.Node, tags ...string) []*html.Node {
+	var found []*html.Node
+	var walk func(*html.Node)
+	walk = func(node *html.Node) {
+		for c := node.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode {
+				for _, tag := range tags {
+					if c.Data == tag {
+						found = append(found, c)
+						break
 					}
-					return // Handled link text, don't traverse children
 				}
 			}
-		}
-
-		for c := node.FirstChild; c != nil; c = c.NextSibling {
 			walk(c)
 		}
+	}
+	walk(n)
+	return found
+}
 
-		// Post-element formatting
-		if node.Type == html.ElementNode {
-			if node.Data == "p" || node.Data == "div" || node.Data == "h1" || node.Data == "h2" || node.Data == "h3" {
-				sb.WriteString("\n")
-			}
-		}
+func newElement(tag string, a atom.Atom) *html.Node {
+	return &html.Node{Type: html.ElementNode, Data: tag, DataAtom: a}
+}
+
+func setNodeTag(n *html.Node, tag string, a atom.Atom) {
+	n.Data = tag
+	n.DataAtom = a
+}
+
+// cloneTree deep-copies n so extraction passes don't disturb the caller's tree,
+// recording each copy's original in origins.
+func cloneTree(n *html.Node, origins map[*html.Node]*html.Node) *html.Node {
+	clone := &html.Node{
+		Type:      n.Type,
+		DataAtom:  n.DataAtom,
+		Data:      n.Data,
+		Namespace: n.Namespace,
+		Attr:      append([]html.Attribute(nil), n.Attr...),
+	}
+	origins[clone] = n
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		clone.AppendChild(cloneTree(c, origins))
 	}
+	return clone
+}
 
-	walk(n)
-	return sb.String()
+// innerText returns the text of n with whitespace collapsed.
+func innerText(n *html.Node) string {
+	return strings.Join(strings.Fields(getTextContent(n)), " ")
 }
 
 func findBody(n *html.Node) *html.Node {
@@ -301,26 +926,3 @@ func getTextContent(n *html.Node) string {
 	walk(n)
 	return strings.TrimSpace(sb.String())
 }
-
-func cleanMarkdown(raw string) string {
-	// Remove empty headers
-	reHeaders := regexp.MustCompile(`(?m)^#+\s*$`)
-	clean := reHeaders.ReplaceAllString(raw, "")
-
-	// Split into lines to trim each one
-	lines := strings.Split(clean, "\n")
-	var trimmedLines []string
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		trimmedLines = append(trimmedLines, trimmed)
-	}
-	clean = strings.Join(trimmedLines, "\n")
-
-	// Collapse multiple newlines (3 or more down to 2)
-	// and then any 2 or more into exactly 2 for consistent spacing
-	reMultiNewline := regexp.MustCompile(`\n{2,}`)
-	clean = reMultiNewline.ReplaceAllString(clean, "\n\n")
-
-	// Final trim for leading/trailing document whitespace
-	return strings.TrimSpace(clean)
-}
@@ -0,0 +1,162 @@
+package utils
+
+import (
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/EasterCompany/dex-web-service/config"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// matchExtractionRule finds the per-domain rule for pageURL, if any.
+func matchExtractionRule(pageURL string) *config.ExtractionRule {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return nil
+	}
+	return config.GetExtractionRules().Match(u.Hostname())
+}
+
+// HasExtractionRule reports whether a per-domain rule applies to pageURL.
+func HasExtractionRule(pageURL string) bool {
+	return matchExtractionRule(pageURL) != nil
+}
+
+// extractWithRule builds the content from the rule's content selectors, after removing
+// matches of the rule's strip selectors and of strip.
+// Returns nil if the rule has none or they match no text, so heuristics can take over.
+func extractWithRule(doc *html.Node, pageURL string, rule *config.ExtractionRule, strip []*Selector) *Extraction {
+	content := compileSelectors(rule.Content)
+	if len(content) == 0 {
+		return nil
+	}
+
+	origins := make(map[*html.Node]*html.Node)
+	page := cloneTree(doc, origins)
+	removeMatches(page, append(strip, compileSelectors(rule.Strip)...))
+	cleanDOM(page, false)
+
+	var matches []*html.Node
+	for _, sel := range content {
+		for _, n := range sel.FindAll(page) {
+			if !containsAny(matches, n) {
+				matches = append(matches, n)
+			}
+		}
+	}
+	if len(matches) == 0 {
+		return nil
+	}
+
+	article := newElement("div", atom.Div)
+	for _, n := range documentOrder(page, matches) {
+		n.Parent.RemoveChild(n)
+		article.AppendChild(n)
+	}
+	if innerText(article) == "" {
+		return nil
+	}
+
+	extraction := &Extraction{Node: article, PageURL: pageURL, origins: origins, sources: []pageSource{{doc, pageURL}}}
+	applyRuleMetadata(extraction, doc, rule)
+	return extraction
+}
+
+// applyRuleMetadata fills title, author and date from the rule's selectors.
+func applyRuleMetadata(e *Extraction, doc *html.Node, rule *config.ExtractionRule) {
+	if rule == nil {
+		return
+	}
+	e.Rule = rule
+	e.Title = selectText(doc, rule.Title)
+	e.Author = selectText(doc, rule.Author)
+
+	if sel := compileSelectors([]string{rule.Date}); len(sel) > 0 {
+		if n := sel[0].FindFirst(doc); n != nil {
+			// Machine-readable dates beat display text like "3 days ago"
+			e.Published = getAttr(n, "datetime")
+			if e.Published == "" {
+				e.Published = getAttr(n, "content")
+			}
+			if e.Published == "" {
+				e.Published = innerText(n)
+			}
+		}
+	}
+}
+
+// selectText returns the text of the first element matching selector.
+func selectText(doc *html.Node, selector string) string {
+	sel := compileSelectors([]string{selector})
+	if len(sel) == 0 {
+		return ""
+	}
+	if n := sel[0].FindFirst(doc); n != nil {
+		return innerText(n)
+	}
+	return ""
+}
+
+// compileSelectors parses rule selectors, logging and skipping the broken ones.
+func compileSelectors(selectors []string) []*Selector {
+	var compiled []*Selector
+	for _, s := range selectors {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		sel, err := ParseSelector(s)
+		if err != nil {
+			log.Printf("Skipping extraction rule selector: %v", err)
+			continue
+		}
+		compiled = append(compiled, sel)
+	}
+	return compiled
+}
+
+// removeMatches deletes every element under root matching any of the selectors.
+func removeMatches(root *html.Node, selectors []*Selector) {
+	for _, sel := range selectors {
+		for _, n := range sel.FindAll(root) {
+			if n.Parent != nil {
+				n.Parent.RemoveChild(n)
+			}
+		}
+	}
+}
+
+// containsAny reports whether n is, or is inside, one of nodes.
+func containsAny(nodes []*html.Node, n *html.Node) bool {
+	for _, candidate := range nodes {
+		for p := n; p != nil; p = p.Parent {
+			if p == candidate {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// documentOrder sorts nodes by their position under root, dropping any nested in another.
+func documentOrder(root *html.Node, nodes []*html.Node) []*html.Node {
+	want := make(map[*html.Node]bool, len(nodes))
+	for _, n := range nodes {
+		want[n] = true
+	}
+
+	var ordered []*html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if want[c] {
+				ordered = append(ordered, c)
+				continue // Nested matches come along with their ancestor
+			}
+			walk(c)
+		}
+	}
+	walk(root)
+	return ordered
+}
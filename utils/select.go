@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// SelectorMatch is one element picked out by a caller-supplied selector.
+type SelectorMatch struct {
+	Tag        string            `json:"tag"`
+	Path       string            `json:"path"`
+	Text       string            `json:"text"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// Elements removed from selections; unlike cleanDOM, page furniture such as nav stays selectable
+var nonContentTags = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true,
+}
+
+// Select returns the elements of doc matching selector, with anything matching
+// exclude removed first. Matches nested inside another match are rendered once, as
+// part of their ancestor. With a nil selector the main content is extracted as usual,
+// minus the excluded elements. No matches is not an error: the content is just empty.
+func Select(doc *html.Node, pageURL string, selector, exclude *Selector) (*Extraction, error) {
+	var strip []*Selector
+	if exclude != nil {
+		strip = append(strip, exclude)
+	}
+	if selector == nil {
+		return extract(doc, pageURL, strip)
+	}
+
+	origins := make(map[*html.Node]*html.Node)
+	page := cloneTree(doc, origins)
+	removeMatches(page, strip)
+	removeNonContent(page)
+
+	matches := selector.FindAll(page)
+	if matches == nil {
+		matches = []*html.Node{} // Marks the extraction as a selection
+	}
+	article := newElement("div", atom.Div)
+	for _, n := range documentOrder(page, matches) {
+		n.Parent.RemoveChild(n)
+		article.AppendChild(n)
+	}
+
+	return &Extraction{
+		Node:    article,
+		PageURL: pageURL,
+		origins: origins,
+		matches: matches,
+		sources: []pageSource{{doc, pageURL}},
+	}, nil
+}
+
+// Matches lists the elements matched by Select, in document order, with their text
+// and attributes. It is nil for extractions that didn't come from a selector.
+func (e *Extraction) Matches() []SelectorMatch {
+	if e.matches == nil {
+		return nil
+	}
+	list := make([]SelectorMatch, 0, len(e.matches))
+	for _, n := range e.matches {
+		match := SelectorMatch{
+			Tag:  n.Data,
+			Path: e.Path(n),
+			Text: cleanMarkdown(nodeToText(n)),
+		}
+		if len(n.Attr) > 0 {
+			match.Attributes = make(map[string]string, len(n.Attr))
+			for _, attr := range n.Attr {
+				match.Attributes[attr.Key] = attr.Val
+			}
+		}
+		list = append(list, match)
+	}
+	return list
+}
+
+// removeNonContent drops comments and elements that never hold readable text.
+func removeNonContent(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch {
+		case c.Type == html.CommentNode:
+			n.RemoveChild(c)
+		case c.Type == html.ElementNode && nonContentTags[c.Data]:
+			n.RemoveChild(c)
+		default:
+			removeNonContent(c)
+		}
+		c = next
+	}
+}
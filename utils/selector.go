@@ -0,0 +1,506 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Selector is a parsed CSS selector group ("a, b") matched against x/net/html trees.
+// Supported: type, #id, .class, [attr] with = ~= |= ^= $= *=, the descendant, child (>),
+// adjacent (+) and sibling (~) combinators, and the :nth-child, :nth-last-child,
+// :nth-of-type, :first-child, :last-child, :only-child and :not pseudo-classes.
+type Selector struct {
+	groups [][]selectorStep // Each chain is stored left to right
+}
+
+// selectorStep is one compound selector and how it relates to the step before it.
+type selectorStep struct {
+	combinator byte // ' ', '>', '+' or '~'; unused on the first step
+	compound   compoundSelector
+}
+
+// compoundSelector is one step of a chain, e.g. div#main.article[lang]:not(.ad)
+type compoundSelector struct {
+	tag     string
+	id      string
+	classes []string
+	attrs   []attrSelector
+	pseudos []pseudoSelector
+}
+
+type attrSelector struct {
+	key string
+	op  string // "" for presence, otherwise the operator
+	val string
+}
+
+type pseudoSelector struct {
+	name string
+	a, b int       // an+b for the nth- pseudo-classes
+	not  *Selector // Argument of :not
+}
+
+// ParseSelector compiles a CSS selector.
+func ParseSelector(selector string) (*Selector, error) {
+	p := &selectorParser{src: selector}
+	s, err := p.parseGroup()
+	if err == nil && p.pos < len(p.src) {
+		err = fmt.Errorf("unexpected %q", p.src[p.pos])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector %q: %w", selector, err)
+	}
+	return s, nil
+}
+
+type selectorParser struct {
+	src string
+	pos int
+}
+
+// parseGroup reads comma-separated chains until the end of input or a closing parenthesis.
+func (p *selectorParser) parseGroup() (*Selector, error) {
+	s := &Selector{}
+	for {
+		chain, err := p.parseChain()
+		if err != nil {
+			return nil, err
+		}
+		s.groups = append(s.groups, chain)
+
+		p.skipSpace()
+		if p.pos >= len(p.src) || p.src[p.pos] != ',' {
+			return s, nil
+		}
+		p.pos++
+	}
+}
+
+func (p *selectorParser) parseChain() ([]selectorStep, error) {
+	var chain []selectorStep
+	combinator := byte(' ')
+	dangling := false
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.src) || p.src[p.pos] == ',' || p.src[p.pos] == ')' {
+			break
+		}
+		start := p.pos
+		compound, err := p.parseCompound()
+		if err != nil {
+			return nil, err
+		}
+		if p.pos == start {
+			return nil, fmt.Errorf("unexpected %q", p.src[p.pos])
+		}
+		chain = append(chain, selectorStep{combinator: combinator, compound: compound})
+		dangling = false
+
+		spaced := p.skipSpace()
+		if p.pos >= len(p.src) {
+			break
+		}
+		switch c := p.src[p.pos]; c {
+		case '>', '+', '~':
+			combinator, dangling = c, true
+			p.pos++
+		case ',', ')':
+		default:
+			if !spaced {
+				return nil, fmt.Errorf("unexpected %q", c)
+			}
+			combinator = ' '
+		}
+	}
+
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("empty selector")
+	}
+	if dangling {
+		return nil, fmt.Errorf("dangling combinator")
+	}
+	return chain, nil
+}
+
+func (p *selectorParser) parseCompound() (compoundSelector, error) {
+	var c compoundSelector
+	if p.peek() == '*' {
+		p.pos++
+	} else if name := p.readName(); name != "" {
+		c.tag = strings.ToLower(name)
+	}
+
+	for p.pos < len(p.src) {
+		switch kind := p.src[p.pos]; kind {
+		case '#', '.':
+			p.pos++
+			name := p.readName()
+			if name == "" {
+				return c, fmt.Errorf("missing name after %q", kind)
+			}
+			if kind == '#' {
+				c.id = name
+			} else {
+				c.classes = append(c.classes, name)
+			}
+		case '[':
+			attr, err := p.parseAttr()
+			if err != nil {
+				return c, err
+			}
+			c.attrs = append(c.attrs, attr)
+		case ':':
+			pseudo, err := p.parsePseudo()
+			if err != nil {
+				return c, err
+			}
+			c.pseudos = append(c.pseudos, pseudo)
+		default:
+			return c, nil
+		}
+	}
+	return c, nil
+}
+
+func (p *selectorParser) parseAttr() (attrSelector, error) {
+	p.pos++ // [
+	p.skipSpace()
+	attr := attrSelector{key: strings.ToLower(p.readName())}
+	if attr.key == "" {
+		return attr, fmt.Errorf("missing attribute name")
+	}
+	p.skipSpace()
+
+	if p.peek() != ']' {
+		for _, op := range []string{"=", "~=", "|=", "^=", "$=", "*="} {
+			if strings.HasPrefix(p.src[p.pos:], op) {
+				attr.op = op
+				p.pos += len(op)
+				break
+			}
+		}
+		if attr.op == "" {
+			return attr, fmt.Errorf("bad attribute operator in [%s", attr.key)
+		}
+		p.skipSpace()
+
+		if q := p.peek(); q == '"' || q == '\'' {
+			end := strings.IndexByte(p.src[p.pos+1:], q)
+			if end < 0 {
+				return attr, fmt.Errorf("unterminated string")
+			}
+			attr.val = p.src[p.pos+1 : p.pos+1+end]
+			p.pos += end + 2
+		} else {
+			attr.val = p.readName()
+		}
+		p.skipSpace()
+	}
+
+	if p.peek() != ']' {
+		return attr, fmt.Errorf("missing ]")
+	}
+	p.pos++
+	return attr, nil
+}
+
+func (p *selectorParser) parsePseudo() (pseudoSelector, error) {
+	p.pos++ // :
+	pseudo := pseudoSelector{name: strings.ToLower(p.readName())}
+
+	switch pseudo.name {
+	case "first-child":
+		pseudo.name, pseudo.b = "nth-child", 1
+		return pseudo, nil
+	case "last-child":
+		pseudo.name, pseudo.b = "nth-last-child", 1
+		return pseudo, nil
+	case "only-child":
+		return pseudo, nil
+	case "not", "nth-child", "nth-last-child", "nth-of-type":
+	default:
+		return pseudo, fmt.Errorf("unsupported pseudo-class :%s", pseudo.name)
+	}
+
+	if p.peek() != '(' {
+		return pseudo, fmt.Errorf(":%s needs an argument", pseudo.name)
+	}
+	p.pos++
+
+	var err error
+	if pseudo.name == "not" {
+		pseudo.not, err = p.parseGroup()
+	} else {
+		end := strings.IndexByte(p.src[p.pos:], ')')
+		if end < 0 {
+			return pseudo, fmt.Errorf("missing )")
+		}
+		pseudo.a, pseudo.b, err = parseNth(p.src[p.pos : p.pos+end])
+		p.pos += end
+	}
+	if err != nil {
+		return pseudo, err
+	}
+
+	p.skipSpace()
+	if p.peek() != ')' {
+		return pseudo, fmt.Errorf("missing )")
+	}
+	p.pos++
+	return pseudo, nil
+}
+
+// parseNth parses the an+b argument of :nth-child and friends, including odd and even.
+func parseNth(arg string) (a, b int, err error) {
+	arg = strings.ToLower(strings.ReplaceAll(arg, " ", ""))
+	switch arg {
+	case "odd":
+		return 2, 1, nil
+	case "even":
+		return 2, 0, nil
+	}
+
+	coefficient, offset, hasN := strings.Cut(arg, "n")
+	if !hasN {
+		if b, err = strconv.Atoi(arg); err != nil {
+			return 0, 0, fmt.Errorf("bad nth argument %q", arg)
+		}
+		return 0, b, nil
+	}
+	switch coefficient {
+	case "", "+":
+		a = 1
+	case "-":
+		a = -1
+	default:
+		if a, err = strconv.Atoi(coefficient); err != nil {
+			return 0, 0, fmt.Errorf("bad nth argument %q", arg)
+		}
+	}
+	if offset != "" {
+		if b, err = strconv.Atoi(offset); err != nil {
+			return 0, 0, fmt.Errorf("bad nth argument %q", arg)
+		}
+	}
+	return a, b, nil
+}
+
+// skipSpace advances past whitespace and reports whether there was any.
+func (p *selectorParser) skipSpace() bool {
+	start := p.pos
+	for p.pos < len(p.src) && strings.IndexByte(" \t\n\r\f", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+	return p.pos > start
+}
+
+func (p *selectorParser) peek() byte {
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+// readName reads an identifier: tag, class, id or attribute name.
+func (p *selectorParser) readName() string {
+	start := p.pos
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '-' || c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80 {
+			p.pos++
+			continue
+		}
+		if c == '\\' && p.pos+1 < len(p.src) {
+			p.pos += 2
+			continue
+		}
+		break
+	}
+	return strings.ReplaceAll(p.src[start:p.pos], "\\", "")
+}
+
+// Match reports whether n matches any selector in the group.
+func (s *Selector) Match(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	for _, chain := range s.groups {
+		if matchChain(n, chain, len(chain)-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchChain matches chain[i] against n and the steps before it against n's
+// ancestors or earlier siblings, backtracking through the descendant and sibling combinators.
+func matchChain(n *html.Node, chain []selectorStep, i int) bool {
+	if !chain[i].compound.match(n) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+
+	switch chain[i].combinator {
+	case '>':
+		p := n.Parent
+		return p != nil && p.Type == html.ElementNode && matchChain(p, chain, i-1)
+	case '+':
+		s := prevElementSibling(n)
+		return s != nil && matchChain(s, chain, i-1)
+	case '~':
+		for s := prevElementSibling(n); s != nil; s = prevElementSibling(s) {
+			if matchChain(s, chain, i-1) {
+				return true
+			}
+		}
+	default:
+		for p := n.Parent; p != nil && p.Type == html.ElementNode; p = p.Parent {
+			if matchChain(p, chain, i-1) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c compoundSelector) match(n *html.Node) bool {
+	if c.tag != "" && n.Data != c.tag {
+		return false
+	}
+	if c.id != "" && getAttr(n, "id") != c.id {
+		return false
+	}
+	if len(c.classes) > 0 {
+		have := strings.Fields(getAttr(n, "class"))
+		for _, want := range c.classes {
+			if !containsString(have, want) {
+				return false
+			}
+		}
+	}
+	for _, attr := range c.attrs {
+		if !attr.match(n) {
+			return false
+		}
+	}
+	for _, pseudo := range c.pseudos {
+		if !pseudo.match(n) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a attrSelector) match(n *html.Node) bool {
+	var val string
+	found := false
+	for _, attr := range n.Attr {
+		if attr.Key == a.key {
+			val, found = attr.Val, true
+			break
+		}
+	}
+	if !found {
+		return false
+	}
+
+	switch a.op {
+	case "":
+		return true
+	case "=":
+		return val == a.val
+	case "~=":
+		return containsString(strings.Fields(val), a.val)
+	case "|=":
+		return val == a.val || strings.HasPrefix(val, a.val+"-")
+	case "^=":
+		return a.val != "" && strings.HasPrefix(val, a.val)
+	case "$=":
+		return a.val != "" && strings.HasSuffix(val, a.val)
+	case "*=":
+		return a.val != "" && strings.Contains(val, a.val)
+	}
+	return false
+}
+
+func (p pseudoSelector) match(n *html.Node) bool {
+	switch p.name {
+	case "not":
+		return !p.not.Match(n)
+	case "only-child":
+		return prevElementSibling(n) == nil && nextElementSibling(n) == nil
+	}
+
+	index := 1
+	step := prevElementSibling
+	if p.name == "nth-last-child" {
+		step = nextElementSibling
+	}
+	for s := step(n); s != nil; s = step(s) {
+		if p.name != "nth-of-type" || s.Data == n.Data {
+			index++
+		}
+	}
+
+	if p.a == 0 {
+		return index == p.b
+	}
+	k := index - p.b
+	return k%p.a == 0 && k/p.a >= 0
+}
+
+func prevElementSibling(n *html.Node) *html.Node {
+	for s := n.PrevSibling; s != nil; s = s.PrevSibling {
+		if s.Type == html.ElementNode {
+			return s
+		}
+	}
+	return nil
+}
+
+func nextElementSibling(n *html.Node) *html.Node {
+	for s := n.NextSibling; s != nil; s = s.NextSibling {
+		if s.Type == html.ElementNode {
+			return s
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// FindAll returns every element under root (excluding root) that matches, in document order.
+func (s *Selector) FindAll(root *html.Node) []*html.Node {
+	var found []*html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if s.Match(c) {
+				found = append(found, c)
+			}
+			walk(c)
+		}
+	}
+	walk(root)
+	return found
+}
+
+// FindFirst returns the first match under root, or nil.
+func (s *Selector) FindFirst(root *html.Node) *html.Node {
+	if found := s.FindAll(root); len(found) > 0 {
+		return found[0]
+	}
+	return nil
+}
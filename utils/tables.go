@@ -0,0 +1,283 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Table is a <table> of a page with its spans resolved into a rectangular grid.
+type Table struct {
+	Index      int        `json:"index"` // Position among the page's tables, from 0
+	Path       string     `json:"path"`  // CSS-style path to the table in the page
+	Caption    string     `json:"caption,omitempty"`
+	Heading    string     `json:"heading,omitempty"` // Nearest heading before the table
+	Columns    []string   `json:"columns"`           // Unique column names, from the header rows
+	HeaderRows int        `json:"header_rows"`       // Rows the column names were read from
+	RowHeaders bool       `json:"row_headers,omitempty"`
+	Rows       [][]string `json:"-"` // Data rows, each as wide as Columns
+}
+
+// tableCell is one slot of a table grid. Spanning cells fill every slot they cover.
+type tableCell struct {
+	node   *html.Node // The td or th; nil for padding
+	text   string
+	header bool // A th, or any cell of a thead
+}
+
+// Largest colspan honoured, as when tables are rendered to Markdown
+const maxTableColspan = 100
+
+var reNumericCell = regexp.MustCompile(`^[-+−]?[$€£¥]?\d[\d,.\s]*%?$`)
+
+// ExtractTables returns the data tables of doc in document order. Layout tables
+// (role=presentation, tables holding other tables, single columns) are skipped.
+func ExtractTables(doc *html.Node) []Table {
+	var tables []Table
+	for _, n := range findAll(doc, "table") {
+		if isLayoutTable(n) {
+			continue
+		}
+		grid := tableGrid(n)
+		if len(grid) == 0 || len(grid[0]) < 2 {
+			continue
+		}
+		table := Table{
+			Index:   len(tables),
+			Path:    domPath(n),
+			Heading: precedingHeading(n),
+		}
+		if captions := findAll(n, "caption"); len(captions) > 0 {
+			table.Caption = collapse(nodeToText(captions[0]))
+		}
+		table.HeaderRows = headerRowCount(grid)
+		headers := grid[:table.HeaderRows]
+		for len(headers) > 0 && isTitleRow(headers[0]) {
+			// A header cell across the whole table titles it, as in infoboxes
+			if table.Caption == "" {
+				table.Caption = headers[0][0].text
+			}
+			headers = headers[1:]
+		}
+		table.Columns = columnNames(headers, len(grid[0]))
+		table.RowHeaders = hasRowHeaders(grid[table.HeaderRows:])
+		for _, row := range grid[table.HeaderRows:] {
+			values := make([]string, len(row))
+			empty := true
+			for i, cell := range row {
+				values[i] = cell.text
+				empty = empty && cell.text == ""
+			}
+			if !empty {
+				table.Rows = append(table.Rows, values)
+			}
+		}
+		tables = append(tables, table)
+	}
+	return tables
+}
+
+// Records returns the data rows as objects keyed by column name.
+func (t Table) Records() []map[string]string {
+	records := make([]map[string]string, len(t.Rows))
+	for i, row := range t.Rows {
+		record := make(map[string]string, len(t.Columns))
+		for j, column := range t.Columns {
+			record[column] = row[j]
+		}
+		records[i] = record
+	}
+	return records
+}
+
+// CSV renders the table as RFC 4180 CSV, column names first.
+func (t Table) CSV() string {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	_ = w.Write(t.Columns)
+	_ = w.WriteAll(t.Rows) // Writes to a buffer can't fail
+	return buf.String()
+}
+
+func isLayoutTable(n *html.Node) bool {
+	switch getAttr(n, "role") {
+	case "presentation", "none":
+		return true
+	}
+	return len(findAll(n, "table")) > 0
+}
+
+// tableGrid lays the rows of table out on a grid, copying cells into every slot their
+// rowspan and colspan cover. rowspan=0 spans the remaining rows. Short rows are padded.
+func tableGrid(table *html.Node) [][]tableCell {
+	rows := tableRows(table)
+	grid := make([][]tableCell, len(rows))
+	width := 0
+	for r, tr := range rows {
+		col := 0
+		for c := tr.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode || (c.Data != "td" && c.Data != "th") {
+				continue
+			}
+			for col < len(grid[r]) && grid[r][col].node != nil {
+				col++
+			}
+			rowspan := len(rows) - r
+			if span, err := strconv.Atoi(getAttr(c, "rowspan")); err != nil || span != 0 {
+				rowspan = min(max(span, 1), rowspan)
+			}
+			colspan := 1
+			if span, err := strconv.Atoi(getAttr(c, "colspan")); err == nil {
+				colspan = min(max(span, 1), maxTableColspan)
+			}
+
+			cell := tableCell{
+				node:   c,
+				text:   collapse(nodeToText(c)),
+				header: c.Data == "th" || hasAncestorTag(c, "thead"),
+			}
+			for dr := 0; dr < rowspan; dr++ {
+				row := grid[r+dr]
+				for len(row) < col+colspan {
+					row = append(row, tableCell{})
+				}
+				for dc := 0; dc < colspan; dc++ {
+					row[col+dc] = cell
+				}
+				grid[r+dr] = row
+			}
+			col += colspan
+		}
+		width = max(width, len(grid[r]))
+	}
+
+	var filled [][]tableCell
+	for _, row := range grid {
+		if len(row) == 0 {
+			continue
+		}
+		for len(row) < width {
+			row = append(row, tableCell{})
+		}
+		filled = append(filled, row)
+	}
+	return filled
+}
+
+// headerRowCount counts the leading rows made only of header cells. Tables without
+// marked-up headers still get one when their first row is all labels over a column
+// of numbers.
+func headerRowCount(grid [][]tableCell) int {
+	count := 0
+	for count < len(grid)-1 && isHeaderRow(grid[count]) {
+		count++
+	}
+	if count > 0 || len(grid) < 2 {
+		return count
+	}
+
+	for _, cell := range grid[0] {
+		if cell.text == "" || isNumericCell(cell.text) {
+			return 0
+		}
+	}
+	for col := range grid[0] {
+		numeric := true
+		for _, row := range grid[1:] {
+			if !isNumericCell(row[col].text) {
+				numeric = false
+				break
+			}
+		}
+		if numeric {
+			return 1
+		}
+	}
+	return 0
+}
+
+func isHeaderRow(row []tableCell) bool {
+	for _, cell := range row {
+		if cell.node != nil && !cell.header {
+			return false
+		}
+	}
+	return true
+}
+
+// isTitleRow reports whether row is a single cell spanning the whole table.
+func isTitleRow(row []tableCell) bool {
+	for _, cell := range row {
+		if cell.node != row[0].node {
+			return false
+		}
+	}
+	return len(row) > 1
+}
+
+// hasRowHeaders reports whether the first column labels the rows: every data row
+// starts with a header cell, and the rest are not all headers too.
+func hasRowHeaders(rows [][]tableCell) bool {
+	if len(rows) == 0 {
+		return false
+	}
+	data := false
+	for _, row := range rows {
+		if !row[0].header {
+			return false
+		}
+		data = data || !isHeaderRow(row)
+	}
+	return data
+}
+
+func isNumericCell(text string) bool {
+	return reNumericCell.MatchString(text)
+}
+
+// columnNames names each column after its header cells, top to bottom, joining
+// the distinct ones with " / ". Columns without a name are column_1, column_2...
+// and repeated names get a numeric suffix.
+func columnNames(headers [][]tableCell, width int) []string {
+	names := make([]string, width)
+	used := make(map[string]bool)
+	for col := range names {
+		var parts []string
+		for _, row := range headers {
+			if text := row[col].text; text != "" && (len(parts) == 0 || parts[len(parts)-1] != text) {
+				parts = append(parts, text)
+			}
+		}
+		name := strings.Join(parts, " / ")
+		if name == "" {
+			name = fmt.Sprintf("column_%d", col+1)
+		}
+		unique := name
+		for i := 2; used[unique]; i++ {
+			unique = fmt.Sprintf("%s_%d", name, i)
+		}
+		used[unique] = true
+		names[col] = unique
+	}
+	return names
+}
+
+// precedingHeading returns the text of the last h1-h6 before n in document order.
+func precedingHeading(n *html.Node) string {
+	for ; n != nil; n = n.Parent {
+		for s := n.PrevSibling; s != nil; s = s.PrevSibling {
+			if headings := findAll(s, "h1", "h2", "h3", "h4", "h5", "h6"); len(headings) > 0 {
+				return innerText(headings[len(headings)-1])
+			}
+			if s.Type == html.ElementNode && len(s.Data) == 2 && s.Data[0] == 'h' && s.Data[1] >= '1' && s.Data[1] <= '6' {
+				return innerText(s)
+			}
+		}
+	}
+	return ""
+}
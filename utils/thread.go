@@ -0,0 +1,621 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ErrNoThread is returned by ExtractThread when a page has no recognisable discussion.
+var ErrNoThread = errors.New("no discussion thread found")
+
+// Thread is the discussion on a forum, comment or Q&A page.
+type Thread struct {
+	Extractor string       `json:"extractor"` // Provider extractor that matched, or "generic"
+	Title     string       `json:"title,omitempty"`
+	Posts     []ThreadPost `json:"posts"`
+}
+
+// ThreadPost is one post or comment, with the replies nested under it.
+type ThreadPost struct {
+	Author    string       `json:"author,omitempty"`
+	Timestamp string       `json:"timestamp,omitempty"` // As the page gives it; RFC 3339 when machine-readable
+	Score     *int         `json:"score,omitempty"`
+	Depth     int          `json:"depth"` // 0 for top-level posts
+	Body      string       `json:"body"`  // Markdown
+	Replies   []ThreadPost `json:"replies,omitempty"`
+}
+
+// threadField locates one part of a post: the first element under the post (skipping
+// nested posts) that matches, and its attribute or, with no attr, its text.
+// A nil match means the post element itself.
+type threadField struct {
+	match func(*html.Node) bool
+	attr  string
+}
+
+// threadProvider extracts the discussion on one site's markup.
+type threadProvider struct {
+	name    string
+	hosts   []string    // Matched with their subdomains; none matches every page
+	title   *Selector   // Thread title, searched for in the whole page
+	opening *Selector   // The post that starts the thread, when it's marked up apart from the replies
+	post    *Selector   // Each reply; nesting in the DOM gives the depth
+	depth   threadField // Depth the markup states, for replies laid out flat
+
+	// Without a body element, the post minus its other parts is the body
+	wholePostBody bool
+
+	author, timestamp, score, body []threadField // Alternatives, tried in order
+}
+
+var threadProviders = []threadProvider{
+	{
+		name:      "hackernews",
+		hosts:     []string{"news.ycombinator.com"},
+		title:     mustSelector("span.titleline > a"),
+		opening:   mustSelector("table.fatitem"),
+		post:      mustSelector("tr.athing.comtr"),
+		depth:     fieldOf("td.ind@indent"),
+		author:    fieldsOf("a.hnuser"),
+		timestamp: fieldsOf("span.age@title", "span.age"),
+		score:     fieldsOf("span.score"),
+		body:      fieldsOf("div.commtext", "div.toptext"),
+	},
+	{
+		// Old Reddit, also served to clients without JavaScript
+		name:      "reddit",
+		hosts:     []string{"reddit.com"},
+		title:     mustSelector("a.title"),
+		opening:   mustSelector("#siteTable div.thing.link"),
+		post:      mustSelector("div.thing.comment"),
+		author:    fieldsOf("@data-author", "a.author"),
+		timestamp: fieldsOf("time@datetime"),
+		score:     fieldsOf(".score.unvoted@title", ".score.unvoted"),
+		body:      fieldsOf("div.usertext-body div.md"),
+	},
+	{
+		name:      "reddit",
+		hosts:     []string{"reddit.com"},
+		title:     mustSelector("h1"),
+		opening:   mustSelector("shreddit-post"),
+		post:      mustSelector("shreddit-comment"),
+		author:    fieldsOf("@author"),
+		timestamp: fieldsOf("@created-timestamp", "time@datetime", "faceplate-timeago@ts"),
+		score:     fieldsOf("@score"),
+		body:      fieldsOf("[slot=text-body]", "[slot=comment]"),
+	},
+	{
+		// schema.org microdata, used by Discourse, Stack Exchange and many forum engines
+		name:      "schema.org",
+		post:      mustSelector(`[itemtype$="/Comment"], [itemtype$="/DiscussionForumPosting"], [itemtype$="/Answer"], [itemtype$="/Question"]`),
+		author:    fieldsOf("[itemprop=author] [itemprop=name]", "[itemprop=author]"),
+		timestamp: fieldsOf("[itemprop=dateCreated]@datetime", "[itemprop=dateCreated]@content", "[itemprop=datePublished]@datetime", "[itemprop=datePublished]@content", "time@datetime"),
+		score:     fieldsOf("[itemprop=upvoteCount]@content", "[itemprop=upvoteCount]"),
+		body:      fieldsOf("[itemprop=text]"),
+	},
+}
+
+// Class, id, itemprop and rel words that mark the parts of a post for the generic extractor
+var (
+	threadAuthorWords    = []string{"author", "user", "username", "poster", "byline", "commenter", "nickname", "nick"}
+	threadTimestampWords = []string{"date", "time", "timestamp", "posted", "ago", "age"}
+	threadScoreWords     = []string{"score", "points", "vote", "votes", "karma", "likes", "upvotes"}
+	threadBodyWords      = []string{"body", "content", "text", "message", "md", "commtext"}
+	threadPostWords      = []string{"comment", "post", "reply", "message", "answer", "entry", "thing", "topic"}
+
+	// Controls around a post that aren't part of what was said
+	threadChromeWords = []string{"reply", "share", "report", "actions", "vote", "toolbar", "permalink", "flag"}
+	threadChromeTags  = map[string]bool{
+		"button": true, "form": true, "input": true, "textarea": true, "select": true,
+		"nav": true, "svg": true, "menu": true,
+	}
+)
+
+var genericThread = threadProvider{
+	name:          "generic",
+	wholePostBody: true,
+	author: []threadField{
+		{match: isThreadMeta(threadAuthorWords)},
+	},
+	timestamp: []threadField{
+		{match: isTimeElement, attr: "datetime"},
+		{match: isTimeElement, attr: "title"},
+		{match: isTimeElement},
+		{match: isThreadMeta(threadTimestampWords), attr: "title"},
+		{match: isThreadMeta(threadTimestampWords)},
+	},
+	score: []threadField{
+		{match: isThreadMeta(threadScoreWords), attr: "title"},
+		{match: isThreadMeta(threadScoreWords)},
+	},
+	body: []threadField{
+		{match: hasAnyWord(threadBodyWords)},
+	},
+}
+
+// Smallest number of elements sharing markup that the generic extractor treats as posts
+const minGenericPosts = 2
+
+// Longest text of an element the generic extractor reads as an author, timestamp or score
+const maxThreadMetaLength = 80
+
+var reScore = regexp.MustCompile(`([-+−]?\d[\d,]*(?:\.\d+)?)\s*([kKmM])?`)
+
+// ExtractThread returns the discussion on a forum, comment or Q&A page as a tree of
+// posts. Sites with their own extractor are tried first; any other page falls back to
+// the largest group of elements that share markup and carry an author or a timestamp.
+func ExtractThread(doc *html.Node, pageURL string) (*Thread, error) {
+	host := ""
+	if u, err := url.Parse(pageURL); err == nil {
+		host = strings.ToLower(u.Hostname())
+	}
+	for i := range threadProviders {
+		p := &threadProviders[i]
+		if !p.matchesHost(host) {
+			continue
+		}
+		var opening *html.Node
+		if p.opening != nil {
+			opening = p.opening.FindFirst(doc)
+		}
+		if thread := p.extract(doc, pageURL, opening, p.post.FindAll(doc)); thread != nil {
+			return thread, nil
+		}
+	}
+	if thread := genericThread.extract(doc, pageURL, nil, repeatedPosts(doc)); thread != nil {
+		return thread, nil
+	}
+	return nil, ErrNoThread
+}
+
+// Markdown renders the thread with each post under a line naming its author, time and
+// score; replies are quoted one level deeper than the post they answer.
+func (t *Thread) Markdown() string {
+	var parts []string
+	if t.Title != "" {
+		parts = append(parts, "# "+escapeMarkdown(t.Title))
+	}
+	for _, post := range t.Posts {
+		parts = append(parts, post.markdown())
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// Text returns the title and the post bodies, for language detection.
+func (t *Thread) Text() string {
+	var parts []string
+	if t.Title != "" {
+		parts = append(parts, t.Title)
+	}
+	var walk func([]ThreadPost)
+	walk = func(posts []ThreadPost) {
+		for _, post := range posts {
+			if post.Body != "" {
+				parts = append(parts, post.Body)
+			}
+			walk(post.Replies)
+		}
+	}
+	walk(t.Posts)
+	return strings.Join(parts, "\n\n")
+}
+
+func (p ThreadPost) markdown() string {
+	var header []string
+	if p.Author != "" {
+		header = append(header, "**"+escapeMarkdown(p.Author)+"**")
+	}
+	if p.Timestamp != "" {
+		header = append(header, escapeMarkdown(p.Timestamp))
+	}
+	if p.Score != nil {
+		header = append(header, fmt.Sprintf("%d points", *p.Score))
+	}
+
+	var parts []string
+	if len(header) > 0 {
+		parts = append(parts, strings.Join(header, " · "))
+	}
+	if p.Body != "" {
+		parts = append(parts, p.Body)
+	}
+	for _, reply := range p.Replies {
+		parts = append(parts, prefixLines(reply.markdown(), "> ", "> "))
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+func (p *threadProvider) matchesHost(host string) bool {
+	if len(p.hosts) == 0 {
+		return true
+	}
+	for _, h := range p.hosts {
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+	return false
+}
+
+// extract builds the thread from the opening post (which may be nil) and the replies.
+// Returns nil when there are no posts.
+func (p *threadProvider) extract(doc *html.Node, pageURL string, opening *html.Node, replies []*html.Node) *Thread {
+	if opening == nil && len(replies) == 0 {
+		return nil
+	}
+	posts := make(map[*html.Node]bool, len(replies)+1)
+	for _, n := range replies {
+		posts[n] = true
+	}
+
+	var flat []ThreadPost
+	base := 0
+	if opening != nil {
+		posts[opening] = true
+		flat = append(flat, p.threadPost(opening, posts, pageURL))
+		base = 1
+	}
+	for _, n := range replies {
+		post := p.threadPost(n, posts, pageURL)
+		post.Depth = base + nestedPostDepth(n, posts)
+		if v := p.depth.value(n, posts); v != "" {
+			if depth, err := strconv.Atoi(v); err == nil && depth > 0 {
+				post.Depth += depth
+			}
+		}
+		flat = append(flat, post)
+	}
+
+	thread := &Thread{Extractor: p.name, Posts: nestPosts(flat)}
+	if p.title != nil {
+		if n := p.title.FindFirst(doc); n != nil {
+			thread.Title = innerText(n)
+		}
+	}
+	if thread.Title == "" {
+		if titles := findAll(doc, "title"); len(titles) > 0 {
+			thread.Title = innerText(titles[0])
+		}
+	}
+	return thread
+}
+
+// threadPost reads the parts of post n. Depth is left to the caller.
+func (p *threadProvider) threadPost(n *html.Node, posts map[*html.Node]bool, pageURL string) ThreadPost {
+	var post ThreadPost
+	meta := make(map[*html.Node]bool)
+	if node, v := findField(n, posts, p.author); node != nil {
+		post.Author, meta[node] = v, true
+	}
+	if node, v := findField(n, posts, p.timestamp); node != nil {
+		post.Timestamp, meta[node] = cleanTimestamp(v), true
+	}
+	for _, field := range p.score {
+		node, v := findField(n, posts, []threadField{field})
+		if score, ok := parseScore(v); node != nil && ok {
+			post.Score, meta[node] = &score, true
+			break
+		}
+	}
+
+	body, _ := findField(n, posts, p.body)
+	if body == nil {
+		if !p.wholePostBody {
+			return post // Deleted posts and link submissions have no body
+		}
+		body = n
+	}
+	post.Body = postMarkdown(body, n, posts, meta, pageURL)
+	return post
+}
+
+// value returns the field's value for post, or "" when it has none.
+func (f threadField) value(post *html.Node, posts map[*html.Node]bool) string {
+	if f.match == nil && f.attr == "" {
+		return ""
+	}
+	_, v := findField(post, posts, []threadField{f})
+	return v
+}
+
+// findField returns the element and value of the first of fields found in post,
+// ignoring nested posts and elements with no value.
+func findField(post *html.Node, posts map[*html.Node]bool, fields []threadField) (*html.Node, string) {
+	for _, f := range fields {
+		if f.match == nil {
+			if v := fieldValue(post, f.attr); v != "" {
+				return post, v
+			}
+			continue
+		}
+		var found *html.Node
+		var value string
+		var walk func(*html.Node)
+		walk = func(n *html.Node) {
+			for c := n.FirstChild; c != nil && found == nil; c = c.NextSibling {
+				if c.Type != html.ElementNode || posts[c] || nonContentTags[c.Data] {
+					continue
+				}
+				if f.match(c) {
+					if v := fieldValue(c, f.attr); v != "" {
+						found, value = c, v
+						return
+					}
+				}
+				walk(c)
+			}
+		}
+		walk(post)
+		if found != nil {
+			return found, value
+		}
+	}
+	return nil, ""
+}
+
+func fieldValue(n *html.Node, attr string) string {
+	if attr == "" {
+		return innerText(n)
+	}
+	return strings.TrimSpace(getAttr(n, attr))
+}
+
+// postMarkdown renders body, a post's body element or the post itself, without nested
+// posts, the elements already read as author, timestamp or score, and reply buttons.
+func postMarkdown(body, post *html.Node, posts, meta map[*html.Node]bool, pageURL string) string {
+	copies := make(map[*html.Node]*html.Node)
+	clone := cloneTree(body, copies)
+	for copied, orig := range copies {
+		if copied.Parent != nil && (posts[orig] && orig != post || meta[orig]) {
+			copied.Parent.RemoveChild(copied)
+		}
+	}
+	removeNonContent(clone)
+	removeThreadChrome(clone)
+
+	root := newElement("div", atom.Div)
+	for c := clone.FirstChild; c != nil; {
+		next := c.NextSibling
+		clone.RemoveChild(c)
+		root.AppendChild(c)
+		c = next
+	}
+	return cleanMarkdown(newMarkdownRenderer(pageURL, false).render(root))
+}
+
+// removeThreadChrome drops forms, buttons and reply or share controls under n.
+func removeThreadChrome(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.ElementNode {
+			if threadChromeTags[c.Data] || isHiddenElement(c) || hasAnyWord(threadChromeWords)(c) {
+				n.RemoveChild(c)
+			} else {
+				removeThreadChrome(c)
+			}
+		}
+		c = next
+	}
+}
+
+// nestedPostDepth counts the posts n is nested in.
+func nestedPostDepth(n *html.Node, posts map[*html.Node]bool) int {
+	depth := 0
+	for p := n.Parent; p != nil; p = p.Parent {
+		if posts[p] {
+			depth++
+		}
+	}
+	return depth
+}
+
+// nestPosts turns posts in document order into a tree: each post's replies are the
+// deeper posts that follow it.
+func nestPosts(flat []ThreadPost) []ThreadPost {
+	posts, _ := nestPostsFrom(flat, 0, -1)
+	return posts
+}
+
+func nestPostsFrom(flat []ThreadPost, i, parentDepth int) ([]ThreadPost, int) {
+	var posts []ThreadPost
+	for i < len(flat) && flat[i].Depth > parentDepth {
+		post := flat[i]
+		post.Replies, i = nestPostsFrom(flat, i+1, post.Depth)
+		posts = append(posts, post)
+	}
+	return posts, i
+}
+
+// repeatedPosts finds the elements most likely to be a page's posts: the largest group
+// of elements with the same tag and classes whose members mostly have an author or a
+// timestamp. Groups named like posts or comments are preferred.
+func repeatedPosts(doc *html.Node) []*html.Node {
+	body := findBody(doc)
+	if body == nil {
+		return nil
+	}
+
+	groups := make(map[string][]*html.Node)
+	var order []string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode || nonContentTags[c.Data] || isHiddenElement(c) {
+				continue
+			}
+			if signature := postSignature(c); signature != "" {
+				if _, seen := groups[signature]; !seen {
+					order = append(order, signature)
+				}
+				groups[signature] = append(groups[signature], c)
+			}
+			walk(c)
+		}
+	}
+	walk(body)
+
+	// Groups are compared in order of first appearance, so a post wins ties with its own body
+	var best []*html.Node
+	bestScore := 0.0
+	for _, signature := range order {
+		members := groups[signature]
+		if len(members) < minGenericPosts {
+			continue
+		}
+		posts := make(map[*html.Node]bool, len(members))
+		for _, n := range members {
+			posts[n] = true
+		}
+		words, withMeta := 0, 0
+		for _, n := range members {
+			words += ownWords(n, posts)
+			if author, _ := findField(n, posts, genericThread.author); author != nil {
+				withMeta++
+			} else if timestamp, _ := findField(n, posts, genericThread.timestamp); timestamp != nil {
+				withMeta++
+			}
+		}
+		if withMeta*2 < len(members) || words < 3*len(members) {
+			continue
+		}
+		score := float64(words) * float64(withMeta) / float64(len(members))
+		if hasAnyWord(threadPostWords)(members[0]) || members[0].Data == "article" {
+			score *= 2
+		}
+		if score > bestScore {
+			best, bestScore = members, score
+		}
+	}
+	return best
+}
+
+// postSignature groups elements by tag and classes, ignoring the numbers in classes
+// like depth-2 or comment-1234. Elements without classes only group as articles.
+func postSignature(n *html.Node) string {
+	var classes []string
+	for _, class := range strings.Fields(getAttr(n, "class")) {
+		if class = strings.TrimRight(class, "0123456789-_"); class != "" {
+			classes = append(classes, class)
+		}
+	}
+	if len(classes) == 0 {
+		if n.Data == "article" {
+			return "article"
+		}
+		return ""
+	}
+	sort.Strings(classes)
+	return n.Data + "." + strings.Join(classes, ".")
+}
+
+// ownWords counts the words under n outside nested posts.
+func ownWords(n *html.Node, posts map[*html.Node]bool) int {
+	count := 0
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		switch {
+		case c.Type == html.TextNode:
+			count += len(strings.Fields(c.Data))
+		case c.Type == html.ElementNode && !posts[c] && !nonContentTags[c.Data]:
+			count += ownWords(c, posts)
+		}
+	}
+	return count
+}
+
+// hasAnyWord matches elements whose class, id, itemprop or rel contains one of words.
+func hasAnyWord(words []string) func(*html.Node) bool {
+	return func(n *html.Node) bool {
+		for _, key := range []string{"class", "id", "itemprop", "rel"} {
+			for _, word := range identifierWords(getAttr(n, key)) {
+				if containsString(words, word) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// isThreadMeta is hasAnyWord for elements short enough to be a byline part, which
+// keeps wrappers like "user-content" from being read as the author.
+func isThreadMeta(words []string) func(*html.Node) bool {
+	named := hasAnyWord(words)
+	return func(n *html.Node) bool {
+		return named(n) && len(innerText(n)) <= maxThreadMetaLength
+	}
+}
+
+func isTimeElement(n *html.Node) bool {
+	return n.DataAtom == atom.Time
+}
+
+// cleanTimestamp keeps the machine-readable part of values like Hacker News'
+// "2024-05-01T12:34:56 1714566896", and returns anything else as it is.
+func cleanTimestamp(v string) string {
+	fields := strings.Fields(v)
+	if len(fields) > 1 {
+		for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05"} {
+			if _, err := time.Parse(layout, fields[0]); err == nil {
+				return fields[0]
+			}
+		}
+	}
+	return v
+}
+
+// parseScore reads a score like "42", "-3", "1,204 points" or "1.2k".
+func parseScore(v string) (int, bool) {
+	m := reScore.FindStringSubmatch(v)
+	if m == nil {
+		return 0, false
+	}
+	number := strings.ReplaceAll(strings.Replace(m[1], "−", "-", 1), ",", "")
+	f, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, false
+	}
+	switch m[2] {
+	case "k", "K":
+		f *= 1e3
+	case "m", "M":
+		f *= 1e6
+	}
+	return int(f), true
+}
+
+// fieldOf parses a field spec: a selector, optionally followed by @attribute. A spec
+// of just @attribute reads the post element itself.
+func fieldOf(spec string) threadField {
+	selector, attr, _ := strings.Cut(spec, "@")
+	f := threadField{attr: attr}
+	if selector != "" {
+		f.match = mustSelector(selector).Match
+	}
+	return f
+}
+
+func fieldsOf(specs ...string) []threadField {
+	fields := make([]threadField, len(specs))
+	for i, spec := range specs {
+		fields[i] = fieldOf(spec)
+	}
+	return fields
+}
+
+// mustSelector parses a built-in selector, panicking on a typo.
+func mustSelector(selector string) *Selector {
+	s, err := ParseSelector(selector)
+	if err != nil {
+		panic(fmt.Sprintf("bad selector %q: %v", selector, err))
+	}
+	return s
+}